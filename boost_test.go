@@ -0,0 +1,100 @@
+package valloxrs485
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestSetBoost(t *testing.T) {
+	v := newTestVallox()
+	v.remoteClientId = 0x27
+	v.writeAllowed = true
+	go drainEvents(v)
+
+	// flags query times out, nothing is written
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	if err := v.SetBoost(ctx, true); err == nil {
+		t.Errorf("expected error when flags are not received")
+	}
+	if pkg := (<-v.out).pkg; pkg.Register != 0 || pkg.Value != Flags6 {
+		t.Errorf("expected query for flags but got %+v", pkg)
+	}
+	if len(v.out) != 0 {
+		t.Errorf("expected nothing written after failed read")
+	}
+
+	for _, test := range []struct {
+		on       bool
+		flags    byte
+		expected byte
+	}{
+		{true, 0x81, 0xa1},
+		{false, 0xa1, 0x81},
+	} {
+		ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+		go func() {
+			o := <-v.out
+			handlePackage(&Package{Source: DeviceMain, Destination: 0x27, Register: o.pkg.Value, Value: test.flags}, v)
+		}()
+		if err := v.SetBoost(ctx, test.on); err != nil {
+			t.Fatal(err)
+		}
+		cancel()
+		if pkg := (<-v.out).pkg; pkg.Destination != DeviceMain || pkg.Register != Flags6 || pkg.Value != test.expected {
+			t.Errorf("expected flags %x but got %+v", test.expected, pkg)
+		}
+	}
+}
+
+func TestBoostActive(t *testing.T) {
+	if active, ok := (Event{Register: Flags6, RawValue: 0x40}).BoostActive(); !ok || !active {
+		t.Errorf("expected boost active")
+	}
+	if _, ok := (Event{Register: FanSpeed, RawValue: 0x40}).BoostActive(); ok {
+		t.Errorf("expected fan speed not to tell boost state")
+	}
+}
+
+func TestMode(t *testing.T) {
+	v := newTestVallox()
+	v.remoteClientId = 0x27
+	v.writeAllowed = true
+	go drainEvents(v)
+	if err := v.SetMode(context.Background(), Mode(5)); !errors.Is(err, ErrInvalidValue) {
+		t.Errorf("expected invalid mode error but got %v", err)
+	}
+
+	flags := byte(0x81)
+	done := make(chan struct{})
+	defer close(done)
+	go func() {
+		for {
+			select {
+			case o := <-v.out:
+				if o.pkg.Register == Flags6 {
+					// the unit activates the function when the switch bit is set
+					flags = o.pkg.Value | (o.pkg.Value&boostSwitchBit)<<1
+				} else if o.pkg.Register == 0 {
+					handlePackage(&Package{Source: DeviceMain, Destination: 0x27, Register: o.pkg.Value, Value: flags}, v)
+				}
+			case <-done:
+				return
+			}
+		}
+	}()
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	if m, err := v.CurrentMode(ctx); err != nil || m != ModeHome {
+		t.Errorf("expected home mode but got %v, %v", m, err)
+	}
+	if err := v.SetMode(ctx, ModeBoost); err != nil {
+		t.Fatal(err)
+	}
+	if m, err := v.CurrentMode(ctx); err != nil || m != ModeBoost {
+		t.Errorf("expected boost mode but got %v, %v", m, err)
+	}
+}
@@ -0,0 +1,68 @@
+package valloxrs485
+
+import (
+	"encoding/json"
+	"io"
+	"sort"
+	"sync"
+)
+
+// valueCache keeps the latest event for each register
+type valueCache struct {
+	mutex  sync.Mutex
+	values map[byte]Event
+}
+
+func (c *valueCache) put(e Event) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	if c.values == nil {
+		c.values = make(map[byte]Event)
+	}
+	if old, found := c.values[e.Register]; !found || !old.Time.After(e.Time) {
+		c.values[e.Register] = e
+	}
+}
+
+func (c *valueCache) get(register byte) (Event, bool) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	e, found := c.values[register]
+	return e, found
+}
+
+// LastValue returns the latest event received for the register.  With
+// Config.NormalizeTempRegisters old temperature registers return the event
+// of the new register.
+func (vallox *Vallox) LastValue(register byte) (Event, bool) {
+	return vallox.cache.get(vallox.eventRegister(register))
+}
+
+// SaveCache writes the latest event of each register to w as JSON.  Each
+// event carries its timestamp so staleness of restored values can be checked.
+func (vallox *Vallox) SaveCache(w io.Writer) error {
+	vallox.cache.mutex.Lock()
+	events := make([]Event, 0, len(vallox.cache.values))
+	for _, e := range vallox.cache.values {
+		events = append(events, e)
+	}
+	vallox.cache.mutex.Unlock()
+
+	sort.Slice(events, func(i, j int) bool { return events[i].Register < events[j].Register })
+	return json.NewEncoder(w).Encode(events)
+}
+
+// LoadCache restores events written by SaveCache.  Values already newer
+// in the cache are kept.
+func (vallox *Vallox) LoadCache(r io.Reader) error {
+	var events []Event
+	if err := json.NewDecoder(r).Decode(&events); err != nil {
+		return err
+	}
+	for _, e := range events {
+		// only valid events are cached, files saved before Valid existed lack it
+		e.Valid = true
+		vallox.cache.put(e)
+	}
+	return nil
+}
@@ -0,0 +1,53 @@
+package valloxrs485
+
+import (
+	"bytes"
+	"testing"
+	"time"
+)
+
+func TestLastValue(t *testing.T) {
+	v := newTestVallox()
+	go drainEvents(v)
+	if _, found := v.LastValue(FanSpeed); found {
+		t.Errorf("expected no value before any events")
+	}
+	handlePackage(&Package{Register: FanSpeed, Value: 0x07}, v)
+	handlePackage(&Package{Register: FanSpeed, Value: 0x0f}, v)
+	if e, found := v.LastValue(FanSpeed); !found || e.Value != 4 {
+		t.Errorf("expected last speed 4 but got %+v", e)
+	}
+}
+
+func TestSaveAndLoadCache(t *testing.T) {
+	v := newTestVallox()
+	go drainEvents(v)
+	handlePackage(&Package{Register: FanSpeed, Value: 0x07}, v)
+	handlePackage(&Package{Register: TempIncomingInside, Value: 0xa0}, v)
+	saved, _ := v.LastValue(FanSpeed)
+
+	var buf bytes.Buffer
+	if err := v.SaveCache(&buf); err != nil {
+		t.Fatalf("save failed: %v", err)
+	}
+
+	restored := newTestVallox()
+	newer := Event{Time: time.Now().Add(time.Hour), Register: TempIncomingInside, Value: 30}
+	restored.cache.put(newer)
+	if err := restored.LoadCache(&buf); err != nil {
+		t.Fatalf("load failed: %v", err)
+	}
+	if e, _ := restored.LastValue(FanSpeed); e.Value != 3 || !e.Time.Equal(saved.Time) {
+		t.Errorf("expected restored speed 3 at %v but got %+v", saved.Time, e)
+	}
+	if e, _ := restored.LastValue(TempIncomingInside); e.Value != 30 {
+		t.Errorf("expected newer value to be kept but got %+v", e)
+	}
+}
+
+func TestLoadCacheInvalid(t *testing.T) {
+	v := newTestVallox()
+	if err := v.LoadCache(bytes.NewBufferString("not json")); err == nil {
+		t.Errorf("expected error for invalid data")
+	}
+}
@@ -0,0 +1,46 @@
+package valloxrs485
+
+import "sync"
+
+type changeCallback struct {
+	fn       func(old, new Event)
+	last     Event
+	lastSeen bool
+}
+
+type changeCallbacks struct {
+	mutex     sync.Mutex
+	callbacks map[byte][]*changeCallback
+}
+
+// OnRegisterChange registers fn to be called when decoded value of the
+// register changes.  The first received value is only recorded as the
+// previous value.  fn is called from the reader goroutine and must not block.
+func (vallox *Vallox) OnRegisterChange(register byte, fn func(old, new Event)) {
+	vallox.changes.mutex.Lock()
+	defer vallox.changes.mutex.Unlock()
+	if vallox.changes.callbacks == nil {
+		vallox.changes.callbacks = make(map[byte][]*changeCallback)
+	}
+	vallox.changes.callbacks[register] = append(vallox.changes.callbacks[register], &changeCallback{fn: fn})
+}
+
+func (cc *changeCallbacks) notify(e Event) {
+	type call struct {
+		fn  func(old, new Event)
+		old Event
+	}
+	var calls []call
+	cc.mutex.Lock()
+	for _, c := range cc.callbacks[e.Register] {
+		if c.lastSeen && c.last.Value != e.Value {
+			calls = append(calls, call{c.fn, c.last})
+		}
+		c.last, c.lastSeen = e, true
+	}
+	cc.mutex.Unlock()
+	// callbacks are called without the lock so they can register callbacks
+	for _, c := range calls {
+		c.fn(c.old, e)
+	}
+}
@@ -0,0 +1,45 @@
+package valloxrs485
+
+import "testing"
+
+func TestOnRegisterChange(t *testing.T) {
+	v := newTestVallox()
+	go drainEvents(v)
+	var changes [][2]int16
+	v.OnRegisterChange(FanSpeed, func(old, new Event) {
+		changes = append(changes, [2]int16{old.Value, new.Value})
+	})
+
+	for _, value := range []byte{0x07, 0x07, 0x0f, 0x0f, 0x07} {
+		handlePackage(&Package{Register: FanSpeed, Value: value}, v)
+		handlePackage(&Package{Register: TempIncomingInside, Value: value}, v)
+	}
+
+	expected := [][2]int16{{3, 4}, {4, 3}}
+	if len(changes) != len(expected) {
+		t.Fatalf("expected changes %v but got %v", expected, changes)
+	}
+	for i := range expected {
+		if changes[i] != expected[i] {
+			t.Errorf("expected change %v but got %v", expected[i], changes[i])
+		}
+	}
+}
+
+func TestOnRegisterChangeFromCallback(t *testing.T) {
+	v := newTestVallox()
+	go drainEvents(v)
+	nested := 0
+	v.OnRegisterChange(FanSpeed, func(old, new Event) {
+		v.OnRegisterChange(FanSpeed, func(old, new Event) { nested++ })
+	})
+
+	for _, value := range []byte{0x07, 0x0f, 0x07, 0x0f} {
+		handlePackage(&Package{Register: FanSpeed, Value: value}, v)
+	}
+
+	// a nested callback records the next value before it sees a change
+	if nested != 1 {
+		t.Errorf("expected 1 nested change but got %d", nested)
+	}
+}
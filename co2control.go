@@ -0,0 +1,90 @@
+package valloxrs485
+
+import (
+	"context"
+	"time"
+)
+
+// co2Hysteresis is the distance from target CO2 ppm before speed is changed
+const co2Hysteresis = 100
+
+// defaultCo2ControlInterval is the minimum time between speed changes, so
+// that CO2 level has time to react to the previous change
+const defaultCo2ControlInterval = 5 * time.Minute
+
+// AutoCo2Control adjusts fan speed one step at a time to keep CO2 near
+// targetPPM.  Speed is kept within fan speed min and max configured in the
+// unit and changed at most once per Config.AutoCo2Interval.  Requires
+// Config.EnableWrite.  Blocks until ctx is cancelled.
+func (vallox *Vallox) AutoCo2Control(ctx context.Context, targetPPM int16) error {
+	if !vallox.writeAllowed {
+		return ErrWriteDisabled
+	}
+
+	// either byte may complete the CO2 value, depending on which is
+	// received last
+	co2High := vallox.addWaiter(Co2HighestHighByte)
+	defer vallox.removeWaiter(Co2HighestHighByte, co2High)
+	co2Low := vallox.addWaiter(Co2HighestLowByte)
+	defer vallox.removeWaiter(Co2HighestLowByte, co2Low)
+	speeds := vallox.addWaiter(FanSpeed)
+	defer vallox.removeWaiter(FanSpeed, speeds)
+
+	queryCtx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	settings, err := vallox.FanSettings(queryCtx)
+	cancel()
+	if err != nil {
+		return err
+	}
+	minSpeed, maxSpeed := int16(1), int16(8)
+	if settings.MinSpeedValid {
+		minSpeed = settings.MinSpeed
+	}
+	if settings.MaxSpeedValid {
+		maxSpeed = settings.MaxSpeed
+	}
+	speed, speedValid := settings.Speed, settings.SpeedValid
+
+	var lastChange time.Time
+	for {
+		var e Event
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case s := <-speeds:
+			speed, speedValid = s.Value, true
+			continue
+		case e = <-co2High:
+		case e = <-co2Low:
+		}
+		if !speedValid || time.Since(lastChange) < vallox.co2ControlInterval {
+			continue
+		}
+		if next := co2SpeedStep(e.Value, targetPPM, speed, minSpeed, maxSpeed); next != speed {
+			vallox.logger.Infof("co2 %d target %d, changing speed %d -> %d", e.Value, targetPPM, speed, next)
+			if err := vallox.SetSpeed(byte(next)); err != nil {
+				vallox.logger.Warnf("co2 control: %v", err)
+				continue
+			}
+			speed = next
+			lastChange = time.Now()
+		}
+	}
+}
+
+// co2SpeedStep returns the fan speed to use for co2 level
+func co2SpeedStep(co2, target, speed, minSpeed, maxSpeed int16) int16 {
+	next := speed
+	if co2 > target+co2Hysteresis {
+		next++
+	} else if co2 < target-co2Hysteresis {
+		next--
+	}
+	if next > maxSpeed {
+		next = maxSpeed
+	}
+	if next < minSpeed {
+		next = minSpeed
+	}
+	return next
+}
@@ -0,0 +1,106 @@
+package valloxrs485
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestCo2SpeedStep(t *testing.T) {
+	assertCo2Step(t, 900, 3, 3)
+	assertCo2Step(t, 1000, 3, 3)
+	assertCo2Step(t, 1200, 3, 4)
+	assertCo2Step(t, 700, 3, 2)
+	// limits
+	assertCo2Step(t, 1200, 6, 6)
+	assertCo2Step(t, 700, 2, 2)
+	// speed outside limits is brought within limits
+	assertCo2Step(t, 900, 8, 6)
+	assertCo2Step(t, 900, 1, 2)
+}
+
+func assertCo2Step(t *testing.T, co2, speed, expected int16) {
+	if s := co2SpeedStep(co2, 900, speed, 2, 6); s != expected {
+		t.Errorf("co2 %d at speed %d expected speed %d but got %d", co2, speed, expected, s)
+	}
+}
+
+func TestAutoCo2ControlRequiresWrite(t *testing.T) {
+	v := newTestVallox()
+	if err := v.AutoCo2Control(context.Background(), 900); !errors.Is(err, ErrWriteDisabled) {
+		t.Errorf("expected error when writing is not enabled")
+	}
+}
+
+func TestAutoCo2Control(t *testing.T) {
+	v := newTestVallox()
+	v.remoteClientId = 0x27
+	v.writeAllowed = true
+	go drainEvents(v)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	done := make(chan error)
+	go func() { done <- v.AutoCo2Control(ctx, 900) }()
+
+	// answer fan settings queries
+	for i := 0; i < 3; i++ {
+		pkg := (<-v.out).pkg
+		values := map[byte]byte{FanSpeed: 0x07, FanSpeedMax: 0x3f, FanSpeedMin: 0x03}
+		handlePackage(&Package{Source: DeviceMain, Destination: 0x27, Register: pkg.Value, Value: values[pkg.Value]}, v)
+	}
+
+	// co2 1200 ppm should increase speed from 3 to 4, the controller may
+	// not be listening yet so keep sending
+	var pkg Package
+	for pkg.Register != FanSpeed {
+		handlePackage(&Package{Source: DeviceMain, Destination: RemoteClientMulticast, Register: Co2HighestHighByte, Value: 0x04}, v)
+		handlePackage(&Package{Source: DeviceMain, Destination: RemoteClientMulticast, Register: Co2HighestLowByte, Value: 0xb0}, v)
+		select {
+		case o := <-v.out:
+			pkg = o.pkg
+		case <-time.After(10 * time.Millisecond):
+		}
+	}
+	if pkg.Value != speedToValue(4) {
+		t.Errorf("expected speed 4 to be set but got %x", pkg.Value)
+	}
+
+	cancel()
+	if err := <-done; err != context.Canceled {
+		t.Errorf("expected context cancelled but got %v", err)
+	}
+}
+
+func TestAutoCo2ControlHighByteLast(t *testing.T) {
+	v := newTestVallox()
+	v.remoteClientId = 0x27
+	v.writeAllowed = true
+	go drainEvents(v)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	done := make(chan error)
+	go func() { done <- v.AutoCo2Control(ctx, 900) }()
+
+	// the controller listens once it has queried fan settings
+	for i := 0; i < 3; i++ {
+		pkg := (<-v.out).pkg
+		values := map[byte]byte{FanSpeed: 0x07, FanSpeedMax: 0x3f, FanSpeedMin: 0x03}
+		handlePackage(&Package{Source: DeviceMain, Destination: 0x27, Register: pkg.Value, Value: values[pkg.Value]}, v)
+	}
+
+	// co2 1200 ppm completed by the high byte
+	handlePackage(&Package{Source: DeviceMain, Destination: RemoteClientMulticast, Register: Co2HighestLowByte, Value: 0xb0}, v)
+	handlePackage(&Package{Source: DeviceMain, Destination: RemoteClientMulticast, Register: Co2HighestHighByte, Value: 0x04}, v)
+	select {
+	case o := <-v.out:
+		if o.pkg.Register != FanSpeed || o.pkg.Value != speedToValue(4) {
+			t.Errorf("expected speed 4 to be set but got %+v", o.pkg)
+		}
+	case <-time.After(time.Second):
+		t.Errorf("speed not changed when high byte completed co2")
+	}
+
+	cancel()
+	<-done
+}
@@ -0,0 +1,60 @@
+package valloxrs485
+
+import (
+	"context"
+	"fmt"
+	"sync"
+)
+
+// clientIdWatch notifies watchers of frames sent from our client id by
+// another device, our own transmissions echoed back are not included
+type clientIdWatch struct {
+	mutex    sync.Mutex
+	watchers []chan Package
+}
+
+func (w *clientIdWatch) add() chan Package {
+	ch := make(chan Package, 1)
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+	w.watchers = append(w.watchers, ch)
+	return ch
+}
+
+func (w *clientIdWatch) remove(ch chan Package) {
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+	for i, c := range w.watchers {
+		if c == ch {
+			w.watchers = append(w.watchers[:i], w.watchers[i+1:]...)
+			return
+		}
+	}
+}
+
+func (w *clientIdWatch) notify(pkg Package) {
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+	for _, ch := range w.watchers {
+		select {
+		case ch <- pkg:
+		default:
+		}
+	}
+}
+
+// CheckClientIdCollision listens to the bus until ctx is done and returns
+// an error if another device sends frames from our RemoteClientId, e.g. a
+// panel configured with the same id.  Frames we sent ourselves and the
+// adapter echoed back are ignored.  Returns nil when ctx is done without a
+// collision.
+func (vallox *Vallox) CheckClientIdCollision(ctx context.Context) error {
+	ch := vallox.clientIdWatch.add()
+	defer vallox.clientIdWatch.remove(ch)
+	select {
+	case pkg := <-ch:
+		return fmt.Errorf("remote client id %x is used by another device, seen frame %x", vallox.remoteClientId, pkg.bytes())
+	case <-ctx.Done():
+		return nil
+	}
+}
@@ -0,0 +1,48 @@
+package valloxrs485
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestCheckClientIdCollision(t *testing.T) {
+	v := newTestVallox()
+	v.remoteClientId = 0x27
+	go drainEvents(v)
+	sent := testFrame(0x27, DeviceMain, 0, FanSpeed)
+	var frame [6]byte
+	copy(frame[:], sent)
+	v.sentFrames.add(frame, time.Now())
+
+	result := make(chan error)
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	go func() { result <- v.CheckClientIdCollision(ctx) }()
+	time.Sleep(10 * time.Millisecond)
+
+	// our own frame echoed back and frames of other devices are not collisions
+	v.buf.Write(sent)
+	v.buf.Write(testFrame(0x21, DeviceMain, 0, FanSpeed))
+	handleBuffer(v)
+	select {
+	case err := <-result:
+		t.Fatalf("unexpected result %v", err)
+	case <-time.After(20 * time.Millisecond):
+	}
+
+	v.buf.Write(testFrame(0x27, DeviceMain, 0, FanSpeed))
+	handleBuffer(v)
+	if err := <-result; err == nil {
+		t.Errorf("expected collision to be detected")
+	}
+}
+
+func TestCheckClientIdNoCollision(t *testing.T) {
+	v := newTestVallox()
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	if err := v.CheckClientIdCollision(ctx); err != nil {
+		t.Errorf("expected no collision but got %v", err)
+	}
+}
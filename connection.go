@@ -0,0 +1,53 @@
+package valloxrs485
+
+// ConnectionState describes the state of connection to the Vallox bus
+type ConnectionState int
+
+const (
+	// Connecting means the device is open but no valid frame has been received yet
+	Connecting ConnectionState = iota
+	// Connected means valid frames have been received from the bus
+	Connected
+	// Disconnected means reading from the device failed
+	Disconnected
+)
+
+func (s ConnectionState) String() string {
+	switch s {
+	case Connecting:
+		return "Connecting"
+	case Connected:
+		return "Connected"
+	case Disconnected:
+		return "Disconnected"
+	}
+	return "Unknown"
+}
+
+// ConnectionStates returns channel receiving connection state changes.
+// Changes are dropped if the channel is not consumed.
+func (vallox *Vallox) ConnectionStates() <-chan ConnectionState {
+	return vallox.states
+}
+
+// Connection returns the current connection state
+func (vallox *Vallox) Connection() ConnectionState {
+	vallox.mutex.Lock()
+	defer vallox.mutex.Unlock()
+	return vallox.state
+}
+
+func (vallox *Vallox) setConnection(state ConnectionState) {
+	vallox.mutex.Lock()
+	changed := vallox.state != state
+	vallox.state = state
+	vallox.mutex.Unlock()
+	if !changed {
+		return
+	}
+	vallox.logger.Infof("connection state %v", state)
+	select {
+	case vallox.states <- state:
+	default:
+	}
+}
@@ -0,0 +1,30 @@
+package valloxrs485
+
+import "testing"
+
+func TestConnectionStates(t *testing.T) {
+	v := newTestVallox()
+	if v.Connection() != Connecting {
+		t.Errorf("expected initial state Connecting but got %v", v.Connection())
+	}
+	port := &fakePort{}
+	port.data = append(port.data, testFrame(DeviceMain, RemoteClientMulticast, FanSpeed, 0x07)...)
+	port.data = append(port.data, testFrame(DeviceMain, RemoteClientMulticast, FanSpeed, 0x0f)...)
+	v.port = port
+	v.readBufferSize = 6
+	go drainEvents(v)
+	// reads both frames and fails with io.EOF
+	handleIncoming(v)
+
+	for _, expected := range []ConnectionState{Connected, Disconnected} {
+		if s := <-v.ConnectionStates(); s != expected {
+			t.Errorf("expected state %v but got %v", expected, s)
+		}
+	}
+	if len(v.states) != 0 {
+		t.Errorf("expected no more state changes")
+	}
+	if v.Connection() != Disconnected {
+		t.Errorf("expected state Disconnected but got %v", v.Connection())
+	}
+}
@@ -0,0 +1,106 @@
+package valloxrs485
+
+import "math"
+
+// RawToTemp converts raw temperature value to Celsius
+func RawToTemp(raw byte) int16 {
+	celsius, _ := valueToTemp(raw, nil)
+	return celsius
+}
+
+// TempToRaw converts Celsius to raw temperature value.  Several raw values
+// map to the same temperature, the middle one of them is returned.
+// Temperatures between table values are rounded up.
+func TempToRaw(celsius int16) (byte, bool) {
+	return tempToValue(celsius)
+}
+
+// RawToRH converts raw humidity value to relative humidity percentage,
+// values below 0x33 are not valid
+func RawToRH(raw byte) (int16, bool) {
+	return valueToRh(raw, nil)
+}
+
+// RHToRaw converts relative humidity percentage 0-100 to raw humidity value
+func RHToRaw(rh int16) (byte, bool) {
+	if rh < 0 || rh > 100 {
+		return 0, false
+	}
+	return byte(math.Round(float64(rh)*2.04 + 51)), true
+}
+
+// RawToSpeed converts raw fan speed value to speed 1-8, or 0 if the fan is off
+func RawToSpeed(raw byte) (int16, bool) {
+	return valueToSpeed(raw, nil)
+}
+
+// SpeedToRaw converts fan speed 1-8, or 0 for fan off, to raw fan speed
+// value.  Writing speed 0 still requires Config.AllowOff.
+func SpeedToRaw(speed int16) (byte, bool) {
+	if speed < 0 || speed > 8 {
+		return 0, false
+	}
+	return speedToValue(int8(speed)), true
+}
+
+// RawToCo2 combines high and low CO2 bytes to ppm, zero or negative values
+// are not valid.  Outdoor air alone contains about 400 ppm so zero never is
+// a genuine reading, it means the sensor has not provided a value.
+func RawToCo2(high, low byte) (int16, bool) {
+	res := int16(high)<<8 + int16(low)
+	if res <= 0 {
+		return -1, false
+	}
+	return res, true
+}
+
+// Co2ToRaw splits CO2 ppm to high and low bytes
+func Co2ToRaw(ppm int16) (high, low byte) {
+	return byte(ppm >> 8), byte(ppm)
+}
+
+// temperatureRegisters are registers with values in Celsius
+var temperatureRegisters = map[byte]bool{
+	TempIncomingOutside:    true,
+	TempOutgoingInside:     true,
+	TempIncomingInside:     true,
+	TempOutgoingOutside:    true,
+	TempIncomingOutsideNew: true,
+	TempOutgoingInsideNew:  true,
+	TempIncomingInsideNew:  true,
+	TempOutgoingOutsideNew: true,
+	HeatingTarget:          true,
+	BypassTemp:             true,
+}
+
+// Celsius returns temperature value of the event in Celsius, false if the
+// event is not a temperature.  Resolution is one degree as given by the
+// conversion table.
+func (e Event) Celsius() (float64, bool) {
+	if !temperatureRegisters[e.Register] {
+		return 0, false
+	}
+	return float64(e.Value), true
+}
+
+// humidityRegisters are humidity sensor registers with values in %RH
+var humidityRegisters = map[byte]bool{
+	RhHighest: true,
+	Rh1:       true,
+	Rh2:       true,
+}
+
+// IsHumidity returns true if the event is a humidity sensor value, the
+// sensor is told by Register: Rh1, Rh2 or RhHighest of them
+func (e Event) IsHumidity() bool {
+	return humidityRegisters[e.Register]
+}
+
+// TempFahrenheit returns temperature value of the event in Fahrenheit,
+// false if the event is not a temperature
+func (e Event) TempFahrenheit() (int16, bool) {
+	if !temperatureRegisters[e.Register] {
+		return 0, false
+	}
+	return int16(math.Round(float64(e.Value)*9/5 + 32)), true
+}
@@ -0,0 +1,82 @@
+package valloxrs485
+
+import "testing"
+
+func TestRawToTemp(t *testing.T) {
+	if c := RawToTemp(246); c != 97 {
+		t.Errorf("expected 97 but got %d", c)
+	}
+	if raw, ok := TempToRaw(20); !ok || RawToTemp(raw) != 20 {
+		t.Errorf("expected 20 to round trip but got raw %d", raw)
+	}
+}
+
+func TestRHRoundTrip(t *testing.T) {
+	for rh := int16(0); rh <= 100; rh++ {
+		raw, ok := RHToRaw(rh)
+		if !ok {
+			t.Fatalf("expected rh %d to be convertible", rh)
+		}
+		if back, ok := RawToRH(raw); !ok || back != rh {
+			t.Errorf("rh %d round trip via raw %x gave %d", rh, raw, back)
+		}
+	}
+	if _, ok := RHToRaw(101); ok {
+		t.Errorf("expected rh 101 not to be convertible")
+	}
+	if _, ok := RawToRH(0x32); ok {
+		t.Errorf("expected raw 0x32 not to be valid")
+	}
+}
+
+func TestSpeedRoundTrip(t *testing.T) {
+	for speed := int16(0); speed <= 8; speed++ {
+		raw, ok := SpeedToRaw(speed)
+		if !ok {
+			t.Fatalf("expected speed %d to be convertible", speed)
+		}
+		if back, ok := RawToSpeed(raw); !ok || back != speed {
+			t.Errorf("speed %d round trip via raw %x gave %d", speed, raw, back)
+		}
+	}
+	for _, speed := range []int16{-1, 9} {
+		if _, ok := SpeedToRaw(speed); ok {
+			t.Errorf("expected speed %d not to be convertible", speed)
+		}
+	}
+	if _, ok := RawToSpeed(0x02); ok {
+		t.Errorf("expected raw 0x02 not to be valid speed")
+	}
+}
+
+func TestCo2RoundTrip(t *testing.T) {
+	high, low := Co2ToRaw(1234)
+	if ppm, ok := RawToCo2(high, low); !ok || ppm != 1234 {
+		t.Errorf("expected 1234 but got %d", ppm)
+	}
+	if _, ok := RawToCo2(0, 0); ok {
+		t.Errorf("expected 0 not to be valid")
+	}
+}
+
+func TestCelsius(t *testing.T) {
+	for _, register := range []byte{TempIncomingOutside, TempOutgoingInsideNew, HeatingTarget} {
+		if c, ok := (Event{Register: register, Value: -12}).Celsius(); !ok || c != -12 {
+			t.Errorf("expected register %x to be -12 C but got %v", register, c)
+		}
+	}
+	if _, ok := (Event{Register: Rh1, Value: 40}).Celsius(); ok {
+		t.Errorf("expected humidity not to be a temperature")
+	}
+}
+
+func TestTempFahrenheit(t *testing.T) {
+	for c, f := range map[int16]int16{-40: -40, 0: 32, 21: 70, 100: 212} {
+		if v, ok := (Event{Register: TempIncomingInside, Value: c}).TempFahrenheit(); !ok || v != f {
+			t.Errorf("expected %d C to be %d F but got %d", c, f, v)
+		}
+	}
+	if _, ok := (Event{Register: FanSpeed, Value: 3}).TempFahrenheit(); ok {
+		t.Errorf("expected fan speed not to be a temperature")
+	}
+}
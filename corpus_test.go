@@ -0,0 +1,95 @@
+package valloxrs485
+
+import (
+	"bufio"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// chunkPort returns each chunk in a separate read
+type chunkPort struct {
+	chunks [][]byte
+}
+
+func (p *chunkPort) Read(b []byte) (int, error) {
+	if len(p.chunks) == 0 {
+		return 0, io.EOF
+	}
+	n := copy(b, p.chunks[0])
+	if p.chunks[0] = p.chunks[0][n:]; len(p.chunks[0]) == 0 {
+		p.chunks = p.chunks[1:]
+	}
+	return n, nil
+}
+
+func (p *chunkPort) Write(b []byte) (int, error) { return len(b), nil }
+
+func (p *chunkPort) Close() error { return nil }
+
+// readCorpus reads a corpus file where lines starting with < contain
+// received bytes in hex, one read per line, and lines starting with >
+// contain expected events as "source destination register raw value"
+func readCorpus(name string) (chunks [][]byte, expected []Event, err error) {
+	f, err := os.Open(name)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer f.Close()
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		line := scanner.Text()
+		switch {
+		case strings.HasPrefix(line, "<"):
+			b, err := hex.DecodeString(strings.ReplaceAll(line[1:], " ", ""))
+			if err != nil {
+				return nil, nil, err
+			}
+			chunks = append(chunks, b)
+		case strings.HasPrefix(line, ">"):
+			var e Event
+			if _, err := fmt.Sscanf(line[1:], "%x %x %x %x %d", &e.Source, &e.Destination, &e.Register, &e.RawValue, &e.Value); err != nil {
+				return nil, nil, fmt.Errorf("%s: %w", line, err)
+			}
+			expected = append(expected, e)
+		}
+	}
+	return chunks, expected, scanner.Err()
+}
+
+func TestDecoderCorpus(t *testing.T) {
+	files, err := filepath.Glob("testdata/corpus/*.txt")
+	if err != nil || len(files) == 0 {
+		t.Fatalf("no corpus files found: %v", err)
+	}
+	for _, file := range files {
+		t.Run(filepath.Base(file), func(t *testing.T) {
+			chunks, expected, err := readCorpus(file)
+			if err != nil {
+				t.Fatal(err)
+			}
+			v := newTestVallox()
+			v.readBufferSize = defaultReadBufferSize
+			v.port = &chunkPort{chunks: chunks}
+			handleIncoming(v)
+			close(v.in)
+
+			var events []Event
+			for e := range v.in {
+				events = append(events, Event{Source: e.Source, Destination: e.Destination, Register: e.Register, RawValue: e.RawValue, Value: e.Value})
+			}
+			if len(events) != len(expected) {
+				t.Fatalf("expected %d events but got %d: %+v", len(expected), len(events), events)
+			}
+			for i := range expected {
+				if events[i] != expected[i] {
+					t.Errorf("expected event %+v but got %+v", expected[i], events[i])
+				}
+			}
+		})
+	}
+}
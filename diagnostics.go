@@ -0,0 +1,59 @@
+package valloxrs485
+
+import "context"
+
+// diagnosticRegisters are registers included in DiagnosticReport
+var diagnosticRegisters = []struct {
+	name     string
+	register byte
+}{
+	{"FanSpeed", FanSpeed},
+	{"FanSpeedMax", FanSpeedMax},
+	{"FanSpeedMin", FanSpeedMin},
+	{"TempIncomingOutside", TempIncomingOutside},
+	{"TempOutgoingInside", TempOutgoingInside},
+	{"TempIncomingInside", TempIncomingInside},
+	{"TempOutgoingOutside", TempOutgoingOutside},
+	{"TempIncomingOutsideNew", TempIncomingOutsideNew},
+	{"TempOutgoingInsideNew", TempOutgoingInsideNew},
+	{"TempIncomingInsideNew", TempIncomingInsideNew},
+	{"TempOutgoingOutsideNew", TempOutgoingOutsideNew},
+	{"RhHighest", RhHighest},
+	{"Rh1", Rh1},
+	{"Rh2", Rh2},
+	{"Co2Highest", Co2HighestLowByte},
+	{"Co2Target", Co2TargetLowByte},
+	{"FaultCode", FaultCode},
+	{"ServiceInterval", ServiceInterval},
+	{"ServiceRemaining", ServiceRemaining},
+	{"HeatingTarget", HeatingTarget},
+	{"Preheating", Preheating},
+	{"SelectRegister", SelectRegister},
+	{"HumidityLimit", HumidityLimit},
+	{"BypassTemp", BypassTemp},
+	{"SupplyFanPercent", SupplyFanPercent},
+	{"ExtractFanPercent", ExtractFanPercent},
+}
+
+// DiagnosticReport queries a set of registers useful for troubleshooting
+// and returns responses by register name.  Units support only some of the
+// registers (e.g. either old or new temperature registers) so the report
+// contains values received before ctx expired.  Error is returned only if
+// nothing responded.
+func (vallox *Vallox) DiagnosticReport(ctx context.Context) (map[string]Event, error) {
+	registers := make([]byte, len(diagnosticRegisters))
+	for i, d := range diagnosticRegisters {
+		registers[i] = d.register
+	}
+	values, err := vallox.QueryValues(ctx, registers...)
+	if len(values) == 0 {
+		return nil, err
+	}
+	report := make(map[string]Event, len(values))
+	for _, d := range diagnosticRegisters {
+		if e, found := values[d.register]; found {
+			report[d.name] = e
+		}
+	}
+	return report, nil
+}
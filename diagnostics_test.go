@@ -0,0 +1,41 @@
+package valloxrs485
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestDiagnosticReport(t *testing.T) {
+	v := newTestVallox()
+	v.remoteClientId = 0x27
+	go drainEvents(v)
+	go respond(v, map[byte]byte{
+		FanSpeed:           0x07,
+		TempIncomingInside: 0xa0,
+		Co2HighestHighByte: 0x02,
+		Co2HighestLowByte:  0x58,
+	})
+
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	report, err := v.DiagnosticReport(ctx)
+	if err != nil {
+		t.Fatalf("expected no error but got %v", err)
+	}
+	if len(report) != 3 {
+		t.Errorf("expected 3 values but got %+v", report)
+	}
+	if report["FanSpeed"].Value != 3 || report["TempIncomingInside"].Value != 20 || report["Co2Highest"].Value != 600 {
+		t.Errorf("unexpected report %+v", report)
+	}
+}
+
+func TestDiagnosticReportNoResponse(t *testing.T) {
+	v := newTestVallox()
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	if _, err := v.DiagnosticReport(ctx); err == nil {
+		t.Errorf("expected error when nothing responds")
+	}
+}
@@ -0,0 +1,83 @@
+package valloxrs485
+
+import "time"
+
+// Discard describes a frame that was received but not delivered as an event
+type Discard struct {
+	Time        time.Time `json:"time"`
+	Source      byte      `json:"source"`
+	Destination byte      `json:"destination"`
+	Register    byte      `json:"register"`
+	RawValue    byte      `json:"raw"`
+	Reason      string    `json:"reason"`
+}
+
+// Range of plausible decoded values, inclusive
+type Range struct {
+	Min int16
+	Max int16
+}
+
+// DefaultPlausibleRanges contains sensible ranges for known sensor registers
+// that can be used as Config.PlausibleRanges
+var DefaultPlausibleRanges = map[byte]Range{
+	TempIncomingOutside:    {-45, 50},
+	TempOutgoingInside:     {-10, 50},
+	TempIncomingInside:     {-10, 50},
+	TempOutgoingOutside:    {-45, 50},
+	TempIncomingOutsideNew: {-45, 50},
+	TempOutgoingInsideNew:  {-10, 50},
+	TempIncomingInsideNew:  {-10, 50},
+	TempOutgoingOutsideNew: {-45, 50},
+	Co2HighestLowByte:      {0, 5000},
+}
+
+const (
+	reasonUndecodable  = "undecodable value"
+	reasonImplausible  = "implausible value"
+	reasonDisconnected = "sensor disconnected"
+	reasonBelowScale   = "humidity below scale"
+)
+
+// Discards returns channel for frames that were received but not delivered
+// as events.  Discards are dropped if the channel is not consumed.
+func (vallox *Vallox) Discards() chan Discard {
+	return vallox.discards
+}
+
+func (vallox *Vallox) plausible(e *Event) bool {
+	r, found := vallox.plausibleRanges[e.Register]
+	return !found || (e.Value >= r.Min && e.Value <= r.Max)
+}
+
+func (vallox *Vallox) discard(pkg *Package, reason string) {
+	vallox.counters.discardedFrames.Add(1)
+	vallox.logger.Debugf("discarding package from %x register %x value %x: %s", pkg.Source, pkg.Register, pkg.Value, reason)
+	d := Discard{
+		Time:        time.Now(),
+		Source:      pkg.Source,
+		Destination: pkg.Destination,
+		Register:    pkg.Register,
+		RawValue:    pkg.Value,
+		Reason:      reason,
+	}
+	select {
+	case vallox.discards <- d:
+	default:
+	}
+}
+
+// sensorDisconnected returns true if pkg is a temperature sensor value
+// configured to indicate a disconnected sensor
+func (vallox *Vallox) sensorDisconnected(pkg *Package) bool {
+	sensor := temperatureRegisters[pkg.Register] && pkg.Register != HeatingTarget && pkg.Register != BypassTemp
+	return sensor && vallox.disconnected[pkg.Value]
+}
+
+// undecodableReason tells why value of pkg could not be decoded
+func undecodableReason(pkg *Package) string {
+	if humidityRegisters[pkg.Register] && pkg.Value < minRhValue {
+		return reasonBelowScale
+	}
+	return reasonUndecodable
+}
@@ -0,0 +1,78 @@
+package valloxrs485
+
+import "testing"
+
+func TestImplausibleDiscarded(t *testing.T) {
+	v := newTestVallox()
+	v.plausibleRanges = DefaultPlausibleRanges
+	handlePackage(&Package{Register: TempIncomingInside, Value: 0}, v)
+	handlePackage(&Package{Register: TempIncomingInside, Value: 0x80}, v)
+
+	d := <-v.discards
+	if d.Register != TempIncomingInside || d.RawValue != 0 || d.Reason != reasonImplausible {
+		t.Errorf("unexpected discard %+v", d)
+	}
+	if e := <-v.in; e.RawValue != 0x80 {
+		t.Errorf("expected plausible value to be delivered but got %+v", e)
+	}
+}
+
+func TestDisconnectedSensorDiscarded(t *testing.T) {
+	v := newTestVallox()
+	v.disconnected = map[byte]bool{0: true, 255: true}
+	handlePackage(&Package{Register: TempOutgoingOutside, Value: 255}, v)
+	handlePackage(&Package{Register: BypassTemp, Value: 0}, v)
+
+	d := <-v.discards
+	if d.Register != TempOutgoingOutside || d.RawValue != 255 || d.Reason != reasonDisconnected {
+		t.Errorf("unexpected discard %+v", d)
+	}
+	if e := <-v.in; e.Register != BypassTemp {
+		t.Errorf("expected setpoint value to be delivered but got %+v", e)
+	}
+}
+
+func TestUndecodableDiscarded(t *testing.T) {
+	v := newTestVallox()
+	handlePackage(&Package{Register: FanSpeed, Value: 0x02}, v)
+	if d := <-v.discards; d.Reason != reasonUndecodable {
+		t.Errorf("unexpected discard %+v", d)
+	}
+	if len(v.in) != 0 {
+		t.Errorf("expected no events")
+	}
+}
+
+func TestEmitInvalid(t *testing.T) {
+	v := newTestVallox()
+	v.emitInvalid = true
+	handlePackage(&Package{Register: FanSpeed, Value: 0x02}, v)
+	handlePackage(&Package{Register: FanSpeed, Value: 0x07}, v)
+	if d := <-v.discards; d.Reason != reasonUndecodable {
+		t.Errorf("unexpected discard %+v", d)
+	}
+	if e := <-v.in; e.Valid || e.Value != 0x02 || e.RawValue != 0x02 {
+		t.Errorf("expected invalid event with raw value but got %+v", e)
+	}
+	if e := <-v.in; !e.Valid || e.Value != 3 {
+		t.Errorf("expected valid event but got %+v", e)
+	}
+	if e, _ := v.LastValue(FanSpeed); e.RawValue != 0x07 {
+		t.Errorf("expected only valid event to be cached but got %+v", e)
+	}
+}
+
+func TestHumidityBelowScaleDiscarded(t *testing.T) {
+	v := newTestVallox()
+	handlePackage(&Package{Register: Rh2, Value: 0x10}, v)
+	if d := <-v.discards; d.Reason != reasonBelowScale || d.Register != Rh2 {
+		t.Errorf("unexpected discard %+v", d)
+	}
+}
+
+func TestDiscardDoesNotBlock(t *testing.T) {
+	v := newTestVallox()
+	for i := 0; i < cap(v.discards)+1; i++ {
+		handlePackage(&Package{Register: Rh1, Value: 0x10}, v)
+	}
+}
@@ -0,0 +1,65 @@
+package valloxrs485
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"time"
+)
+
+// DiscoverRemotes listens to the bus for duration d, or until ctx is done,
+// and returns remote client addresses (0x20-0x2f) that transmitted.  Our
+// own address is included if the adapter echoes our transmissions.
+func (vallox *Vallox) DiscoverRemotes(ctx context.Context, d time.Duration) []byte {
+	return vallox.listenSources(ctx, d, func(src byte) bool {
+		return src > RemoteClientMulticast && src <= 0x2f
+	})
+}
+
+// ScanDevices listens to the bus until ctx is done and returns addresses of
+// all devices that transmitted, main devices (0x11-0x1f) and remote clients
+// (0x21-0x2f).  Nothing is sent, so scanning is safe on a live bus.  Error is
+// returned only if no device transmitted.
+func (vallox *Vallox) ScanDevices(ctx context.Context) ([]byte, error) {
+	devices := vallox.listenSources(ctx, 0, func(src byte) bool {
+		return IsMainDevice(src) || (src > RemoteClientMulticast && src <= 0x2f)
+	})
+	if len(devices) == 0 {
+		return nil, fmt.Errorf("no devices seen: %w", ctx.Err())
+	}
+	return devices, nil
+}
+
+// listenSources returns sorted source addresses accepted by filter seen
+// during d, or until ctx is done if d is 0
+func (vallox *Vallox) listenSources(ctx context.Context, d time.Duration, filter func(byte) bool) []byte {
+	ch := vallox.subscriptions.add(func(e Event) bool { return filter(e.Source) })
+	defer vallox.subscriptions.remove(ch)
+	var expired <-chan time.Time
+	if d > 0 {
+		timer := time.NewTimer(d)
+		defer timer.Stop()
+		expired = timer.C
+	}
+
+	seen := make(map[byte]bool)
+	for {
+		select {
+		case e := <-ch:
+			seen[e.Source] = true
+		case <-expired:
+			return sortedAddresses(seen)
+		case <-ctx.Done():
+			return sortedAddresses(seen)
+		}
+	}
+}
+
+func sortedAddresses(seen map[byte]bool) []byte {
+	addresses := make([]byte, 0, len(seen))
+	for a := range seen {
+		addresses = append(addresses, a)
+	}
+	sort.Slice(addresses, func(i, j int) bool { return addresses[i] < addresses[j] })
+	return addresses
+}
@@ -0,0 +1,53 @@
+package valloxrs485
+
+import (
+	"bytes"
+	"context"
+	"testing"
+	"time"
+)
+
+func TestDiscoverRemotes(t *testing.T) {
+	v := newTestVallox()
+	go drainEvents(v)
+	go func() {
+		// keep transmitting until discovery is listening
+		for i := 0; i < 10; i++ {
+			for _, src := range []byte{0x23, DeviceMain, 0x21, 0x23, 0x30} {
+				handlePackage(&Package{Source: src, Destination: DeviceMain, Register: 0, Value: FanSpeed}, v)
+			}
+			time.Sleep(5 * time.Millisecond)
+		}
+	}()
+
+	remotes := v.DiscoverRemotes(context.Background(), 40*time.Millisecond)
+	if !bytes.Equal(remotes, []byte{0x21, 0x23}) {
+		t.Errorf("expected remotes 21 and 23 but got %x", remotes)
+	}
+}
+
+func TestScanDevices(t *testing.T) {
+	v := newTestVallox()
+	go drainEvents(v)
+	go func() {
+		for i := 0; i < 10; i++ {
+			for _, src := range []byte{0x23, DeviceMain, RemoteClientMulticast, 0x30} {
+				handlePackage(&Package{Source: src, Destination: DeviceMain, Register: 0, Value: FanSpeed}, v)
+			}
+			time.Sleep(5 * time.Millisecond)
+		}
+	}()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 40*time.Millisecond)
+	defer cancel()
+	devices, err := v.ScanDevices(ctx)
+	if err != nil || !bytes.Equal(devices, []byte{DeviceMain, 0x23}) {
+		t.Errorf("expected devices 11 and 23 but got %x, %v", devices, err)
+	}
+
+	ctx, cancel = context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	if _, err := newTestVallox().ScanDevices(ctx); err == nil {
+		t.Errorf("expected error when no device transmits")
+	}
+}
@@ -0,0 +1,33 @@
+package valloxrs485
+
+import "time"
+
+// efficiencyMaxAge is the maximum age of temperatures used by Efficiency
+const efficiencyMaxAge = 5 * time.Minute
+
+// minEfficiencyTempDiff is the minimum difference between inside and outside
+// temperatures in Celsius for meaningful efficiency with one degree resolution
+const minEfficiencyTempDiff = 3
+
+// Efficiency returns supply and extract side heat recovery efficiency as
+// fraction 0-1 calculated from the latest received temperatures.  ok is false
+// if any temperature is older than five minutes or inside and outside
+// temperatures are too close to each other.
+func (vallox *Vallox) Efficiency() (supply float64, extract float64, ok bool) {
+	s := vallox.Snapshot()
+	temps := []Reading{s.TempIncomingOutside, s.TempIncomingInside, s.TempOutgoingInside, s.TempOutgoingOutside}
+	for _, r := range temps {
+		if !r.Valid || s.Time.Sub(r.At) > efficiencyMaxAge {
+			return 0, 0, false
+		}
+	}
+	outside := float64(s.TempIncomingOutside.Value)
+	inside := float64(s.TempOutgoingInside.Value)
+	diff := inside - outside
+	if diff > -minEfficiencyTempDiff && diff < minEfficiencyTempDiff {
+		return 0, 0, false
+	}
+	supply = (float64(s.TempIncomingInside.Value) - outside) / diff
+	extract = (inside - float64(s.TempOutgoingOutside.Value)) / diff
+	return supply, extract, true
+}
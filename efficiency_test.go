@@ -0,0 +1,38 @@
+package valloxrs485
+
+import (
+	"math"
+	"testing"
+	"time"
+)
+
+func TestEfficiency(t *testing.T) {
+	v := newTestVallox()
+	if _, _, ok := v.Efficiency(); ok {
+		t.Errorf("expected no efficiency without temperatures")
+	}
+
+	now := time.Now()
+	v.cache.put(Event{Time: now, Register: TempIncomingOutside, Value: -10})
+	v.cache.put(Event{Time: now, Register: TempIncomingInside, Value: 14})
+	v.cache.put(Event{Time: now, Register: TempOutgoingInside, Value: 20})
+	v.cache.put(Event{Time: now, Register: TempOutgoingOutsideNew, Value: -1})
+	supply, extract, ok := v.Efficiency()
+	if !ok || math.Abs(supply-0.8) > 1e-9 || math.Abs(extract-0.7) > 1e-9 {
+		t.Errorf("expected efficiency 0.8 and 0.7 but got %v %v %v", supply, extract, ok)
+	}
+
+	// stale
+	v.cache.put(Event{Time: now.Add(-time.Hour), Register: TempOutgoingOutside, Value: -1})
+	v.cache.values[TempOutgoingOutsideNew] = Event{Time: now.Add(-time.Hour), Register: TempOutgoingOutsideNew, Value: -1}
+	if _, _, ok := v.Efficiency(); ok {
+		t.Errorf("expected no efficiency with stale temperature")
+	}
+
+	// inside and outside too close
+	v.cache.put(Event{Time: now, Register: TempOutgoingOutside, Value: 19})
+	v.cache.put(Event{Time: now, Register: TempIncomingOutside, Value: 19})
+	if _, _, ok := v.Efficiency(); ok {
+		t.Errorf("expected no efficiency with small temperature difference")
+	}
+}
@@ -0,0 +1,82 @@
+package valloxrs485
+
+import (
+	"errors"
+	"fmt"
+)
+
+// ErrFramingMismatch is reported when many consecutive bytes were discarded
+// without finding a valid frame, which suggests wrong serial settings
+var ErrFramingMismatch = errors.New("possible framing mismatch")
+
+// ErrLineStuck is reported when the same byte is received repeatedly without
+// a valid frame, which suggests a broken transceiver or floating line
+var ErrLineStuck = errors.New("line stuck or floating")
+
+// ErrRead is reported when reading from the device fails and reading stops,
+// e.g. when the USB adapter is unplugged
+var ErrRead = errors.New("reading device failed")
+
+// ErrWrite is reported when writing a frame to the device fails
+var ErrWrite = errors.New("writing device failed")
+
+// ErrIdle is reported when no valid frame has been received within
+// Config.IdleTimeout, e.g. when the unit is powered off or wiring is broken
+var ErrIdle = errors.New("no frames received")
+
+// ErrInvalidValue is returned when a value to write, or its destination,
+// is out of the allowed range
+var ErrInvalidValue = errors.New("invalid value")
+
+// ErrWriteDisabled is returned when writing without Config.EnableWrite
+var ErrWriteDisabled = errors.New("writing is not enabled")
+
+// ErrNotWritable is returned when writing a register not allowed to be
+// written, see Config.WritableRegisters
+var ErrNotWritable = errors.New("register is not writable")
+
+// ErrQueueFull is returned when a frame cannot be queued for sending
+// because the outgoing queue is full, e.g. when the bus is too busy
+var ErrQueueFull = errors.New("outgoing queue full")
+
+// ErrNotReceived is returned when a value needed by the operation has not
+// been received from the unit
+var ErrNotReceived = errors.New("value not received")
+
+// ErrRemotesNotUpdated is returned by SetSpeed when the speed was queued to
+// the main device but multicasting it to remote clients failed
+var ErrRemotesNotUpdated = errors.New("speed not sent to remote clients")
+
+// Errors returns channel for errors detected while communicating with the
+// bus.  Errors are dropped if the channel is not consumed.  The channel is
+// closed by Close.
+func (vallox *Vallox) Errors() chan error {
+	return vallox.errors
+}
+
+func (vallox *Vallox) reportError(err error) {
+	vallox.logger.Warnf("error: %v", err)
+	vallox.errorsMutex.Lock()
+	defer vallox.errorsMutex.Unlock()
+	if vallox.errorsClosed {
+		return
+	}
+	select {
+	case vallox.errors <- err:
+	default:
+	}
+}
+
+// closeErrors closes errors channel, later errors are only logged
+func (vallox *Vallox) closeErrors() {
+	vallox.errorsMutex.Lock()
+	defer vallox.errorsMutex.Unlock()
+	if !vallox.errorsClosed {
+		vallox.errorsClosed = true
+		close(vallox.errors)
+	}
+}
+
+func wrapError(sentinel, err error) error {
+	return fmt.Errorf("%w: %w", sentinel, err)
+}
@@ -0,0 +1,108 @@
+package valloxrs485
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"testing"
+)
+
+func TestDesyncReported(t *testing.T) {
+	v := newTestVallox()
+	v.desyncThreshold = 10
+	go drainEvents(v)
+
+	// noise shorter than threshold between valid frames is not reported
+	v.buf.Write(bytes.Repeat([]byte{0x55}, 9))
+	v.buf.Write(testFrame(DeviceMain, RemoteClientMulticast, FanSpeed, 0x07))
+	v.buf.Write(bytes.Repeat([]byte{0x55}, 9))
+	v.buf.Write(testFrame(DeviceMain, RemoteClientMulticast, FanSpeed, 0x07))
+	handleBuffer(v)
+	if len(v.errors) != 0 {
+		t.Fatalf("expected no errors but got %v", <-v.errors)
+	}
+
+	v.buf.Write(bytes.Repeat([]byte{0x55}, 25))
+	handleBuffer(v)
+	if err := <-v.errors; !errors.Is(err, ErrFramingMismatch) {
+		t.Errorf("expected framing mismatch but got %v", err)
+	}
+	if len(v.errors) != 1 {
+		t.Errorf("expected framing mismatch reported every 10 bytes, got %d more", len(v.errors))
+	}
+}
+
+func TestDesyncDisabled(t *testing.T) {
+	v := newTestVallox()
+	v.buf.Write(bytes.Repeat([]byte{0x55}, 100))
+	handleBuffer(v)
+	if len(v.errors) != 0 {
+		t.Errorf("expected no errors when check is disabled")
+	}
+}
+
+func TestStuckLineReported(t *testing.T) {
+	v := newTestVallox()
+	v.stuckThreshold = 20
+	// varying noise is not a stuck line
+	for i := 0; i < 50; i++ {
+		v.buf.WriteByte(byte(i*7 + 2))
+	}
+	handleBuffer(v)
+	if len(v.errors) != 0 {
+		t.Fatalf("expected no errors but got %v", <-v.errors)
+	}
+
+	v.buf.Write(bytes.Repeat([]byte{0xff}, 30))
+	handleBuffer(v)
+	if err := <-v.errors; !errors.Is(err, ErrLineStuck) {
+		t.Errorf("expected stuck line but got %v", err)
+	}
+	if len(v.errors) != 0 {
+		t.Errorf("expected only one error")
+	}
+}
+
+// failingPort fails all reads and writes
+type failingPort struct{}
+
+func (failingPort) Read(b []byte) (int, error)  { return 0, io.ErrUnexpectedEOF }
+func (failingPort) Write(b []byte) (int, error) { return 0, io.ErrClosedPipe }
+func (failingPort) Close() error                { return nil }
+
+func TestReadFailureReported(t *testing.T) {
+	v := newTestVallox()
+	v.port = failingPort{}
+	handleIncoming(v)
+	if err := <-v.errors; !errors.Is(err, ErrRead) || !errors.Is(err, io.ErrUnexpectedEOF) {
+		t.Errorf("expected read error but got %v", err)
+	}
+	if v.Connection() != Disconnected {
+		t.Errorf("expected disconnected state but got %v", v.Connection())
+	}
+}
+
+func TestWriteFailureReported(t *testing.T) {
+	v := newTestVallox()
+	v.port = failingPort{}
+	v.running.Store(true)
+	go handleOutgoing(v)
+	defer v.Close()
+	if err := <-v.SubmitWrite(DeviceMain, 0, FanSpeed); !errors.Is(err, ErrWrite) {
+		t.Errorf("expected write error from submit but got %v", err)
+	}
+	if err := <-v.errors; !errors.Is(err, ErrWrite) || !errors.Is(err, io.ErrClosedPipe) {
+		t.Errorf("expected write error but got %v", err)
+	}
+}
+
+func TestErrorsClosedOnClose(t *testing.T) {
+	v := newTestVallox()
+	v.port = failingPort{}
+	v.Close()
+	if _, ok := <-v.Errors(); ok {
+		t.Errorf("expected errors channel to be closed")
+	}
+	// reporting after close must not panic
+	v.reportError(ErrLineStuck)
+}
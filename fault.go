@@ -0,0 +1,29 @@
+package valloxrs485
+
+// DefaultFaultDescriptions describes codes of the FaultCode register on
+// Digit units.  Codes differ between model generations, Config.FaultDescriptions
+// can be used to replace the table.
+var DefaultFaultDescriptions = map[byte]string{
+	0:  "no fault",
+	5:  "supply air sensor fault",
+	6:  "carbon dioxide alarm",
+	7:  "outdoor air sensor fault",
+	8:  "extract air sensor fault",
+	9:  "water coil freezing danger",
+	10: "exhaust air sensor fault",
+}
+
+// FaultDescription returns description of fault code from DefaultFaultDescriptions
+func FaultDescription(raw byte) (string, bool) {
+	text, found := DefaultFaultDescriptions[raw]
+	return text, found
+}
+
+// faultText returns description of fault code using the configured table
+func (vallox *Vallox) faultText(raw byte) string {
+	descriptions := vallox.faultDescriptions
+	if descriptions == nil {
+		descriptions = DefaultFaultDescriptions
+	}
+	return descriptions[raw]
+}
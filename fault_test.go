@@ -0,0 +1,26 @@
+package valloxrs485
+
+import "testing"
+
+func TestFaultDescription(t *testing.T) {
+	if text, ok := FaultDescription(9); !ok || text != "water coil freezing danger" {
+		t.Errorf("unexpected description %q", text)
+	}
+	if _, ok := FaultDescription(0xee); ok {
+		t.Errorf("expected unknown code")
+	}
+}
+
+func TestFaultEventText(t *testing.T) {
+	v := newTestVallox()
+	if e := event(&Package{Register: FaultCode, Value: 7}, v); e.Value != 7 || e.Text != "outdoor air sensor fault" {
+		t.Errorf("unexpected event %+v", e)
+	}
+	if e := event(&Package{Register: FanSpeed, Value: 7}, v); e.Text != "" {
+		t.Errorf("expected no text for fan speed but got %q", e.Text)
+	}
+	v.faultDescriptions = map[byte]string{7: "custom"}
+	if e := event(&Package{Register: FaultCode, Value: 7}, v); e.Text != "custom" {
+		t.Errorf("expected overridden description but got %q", e.Text)
+	}
+}
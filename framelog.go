@@ -0,0 +1,32 @@
+package valloxrs485
+
+import (
+	"fmt"
+	"time"
+)
+
+// Directions used in frame log
+const (
+	frameReceived    = "rx"
+	frameTransmitted = "tx"
+)
+
+// logFrame writes frame to Config.FrameLog as a line
+//
+//	<RFC 3339 timestamp with nanoseconds>,<rx|tx>,<frame as 12 hex digits>
+//
+// for example
+//
+//	2024-01-02T15:04:05.123456789+02:00,rx,011120290760
+func (vallox *Vallox) logFrame(direction string, pkg *Package) {
+	if vallox.frameLog == nil {
+		return
+	}
+	frame := pkg.bytes()
+	vallox.frameLogMutex.Lock()
+	defer vallox.frameLogMutex.Unlock()
+	_, err := fmt.Fprintf(vallox.frameLog, "%s,%s,%x\n", time.Now().Format(time.RFC3339Nano), direction, frame[:])
+	if err != nil {
+		vallox.logger.Warnf("unable to write frame log: %v", err)
+	}
+}
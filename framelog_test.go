@@ -0,0 +1,41 @@
+package valloxrs485
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestFrameLog(t *testing.T) {
+	var log bytes.Buffer
+	v := newTestVallox()
+	v.remoteClientId = 0x27
+	v.frameLog = &log
+	go drainEvents(v)
+	v.buf.Write(testFrame(DeviceMain, RemoteClientMulticast, FanSpeed, 0x07))
+	handleBuffer(v)
+
+	pkg := createWrite(v, DeviceMain, FanSpeed, 0x0f)
+	v.logFrame(frameTransmitted, pkg)
+
+	lines := strings.Split(strings.TrimSpace(log.String()), "\n")
+	if len(lines) != 2 {
+		t.Fatalf("expected 2 lines but got %q", log.String())
+	}
+	assertFrameLogLine(t, lines[0], "rx", "011120290762")
+	assertFrameLogLine(t, lines[1], "tx", "012711290f71")
+}
+
+func assertFrameLogLine(t *testing.T, line, direction, frame string) {
+	fields := strings.Split(line, ",")
+	if len(fields) != 3 {
+		t.Fatalf("expected 3 fields in %q", line)
+	}
+	if _, err := time.Parse(time.RFC3339Nano, fields[0]); err != nil {
+		t.Errorf("invalid timestamp in %q: %v", line, err)
+	}
+	if fields[1] != direction || fields[2] != frame {
+		t.Errorf("expected %s %s but got %q", direction, frame, line)
+	}
+}
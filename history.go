@@ -0,0 +1,66 @@
+package valloxrs485
+
+import "sync"
+
+// history keeps the latest events for each register in ring buffers
+type history struct {
+	mutex  sync.Mutex
+	size   int
+	events map[byte]*eventRing
+}
+
+type eventRing struct {
+	events []Event
+	next   int
+}
+
+func newHistory(size int) *history {
+	return &history{size: size, events: make(map[byte]*eventRing)}
+}
+
+func (h *history) add(e Event) {
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+	ring, found := h.events[e.Register]
+	if !found {
+		ring = &eventRing{events: make([]Event, 0, h.size)}
+		h.events[e.Register] = ring
+	}
+	if len(ring.events) < h.size {
+		ring.events = append(ring.events, e)
+	} else {
+		ring.events[ring.next] = e
+	}
+	ring.next = (ring.next + 1) % h.size
+}
+
+// latest returns up to n latest events in the order they were received
+func (h *history) latest(register byte, n int) []Event {
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+	ring, found := h.events[register]
+	if !found || n <= 0 {
+		return nil
+	}
+	if n > len(ring.events) {
+		n = len(ring.events)
+	}
+	res := make([]Event, n)
+	start := ring.next - n
+	if len(ring.events) < h.size {
+		start = len(ring.events) - n
+	}
+	for i := range res {
+		res[i] = ring.events[(start+i+h.size)%h.size]
+	}
+	return res
+}
+
+// History returns up to n latest events for the register, oldest first.
+// History is kept only if Config.HistorySize is set.
+func (vallox *Vallox) History(register byte, n int) []Event {
+	if vallox.history == nil {
+		return nil
+	}
+	return vallox.history.latest(register, n)
+}
@@ -0,0 +1,39 @@
+package valloxrs485
+
+import "testing"
+
+func TestHistory(t *testing.T) {
+	v := newTestVallox()
+	if h := v.History(FanSpeed, 3); h != nil {
+		t.Errorf("expected no history when disabled but got %v", h)
+	}
+
+	v.history = newHistory(3)
+	for _, value := range []byte{0x01, 0x03, 0x07, 0x0f} {
+		handlePackage(&Package{System: 1, Source: DeviceMain, Destination: RemoteClientMulticast, Register: FanSpeed, Value: value}, v)
+		<-v.in
+	}
+
+	assertHistory(t, v.History(FanSpeed, 10), 2, 3, 4)
+	assertHistory(t, v.History(FanSpeed, 2), 3, 4)
+	assertHistory(t, v.History(TempIncomingInside, 2))
+}
+
+func TestHistoryNotFull(t *testing.T) {
+	h := newHistory(5)
+	h.add(Event{Register: FanSpeed, Value: 1})
+	h.add(Event{Register: FanSpeed, Value: 2})
+	assertHistory(t, h.latest(FanSpeed, 5), 1, 2)
+	assertHistory(t, h.latest(FanSpeed, 1), 2)
+}
+
+func assertHistory(t *testing.T, events []Event, values ...int16) {
+	if len(events) != len(values) {
+		t.Fatalf("expected %d events but got %d", len(values), len(events))
+	}
+	for i, e := range events {
+		if e.Value != values[i] {
+			t.Errorf("expected value %d at %d but got %d", values[i], i, e.Value)
+		}
+	}
+}
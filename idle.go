@@ -0,0 +1,52 @@
+package valloxrs485
+
+import (
+	"fmt"
+	"time"
+)
+
+// LastReceived returns the time the latest valid frame was received, zero
+// if none has been received
+func (vallox *Vallox) LastReceived() time.Time {
+	vallox.mutex.Lock()
+	defer vallox.mutex.Unlock()
+	return vallox.lastFrame
+}
+
+func (vallox *Vallox) updateLastFrame() {
+	vallox.mutex.Lock()
+	defer vallox.mutex.Unlock()
+	vallox.lastFrame = time.Now()
+}
+
+// minIdleTick is the shortest interval for checking idle timeout, so that
+// tiny timeouts do not spin or make an invalid ticker
+const minIdleTick = time.Millisecond
+
+// handleIdle reports ErrIdle once each time the bus has been without valid
+// frames for the idle timeout, started is used before the first frame
+func handleIdle(vallox *Vallox, started time.Time) {
+	tick := vallox.idleTimeout / 4
+	if tick < minIdleTick {
+		tick = minIdleTick
+	}
+	ticker := time.NewTicker(tick)
+	defer ticker.Stop()
+	reported := false
+	for {
+		select {
+		case now := <-ticker.C:
+			last := vallox.LastReceived()
+			if last.Before(started) {
+				last = started
+			}
+			idle := now.Sub(last) >= vallox.idleTimeout
+			if idle && !reported {
+				vallox.reportError(fmt.Errorf("%w within %v", ErrIdle, vallox.idleTimeout))
+			}
+			reported = idle
+		case <-vallox.done:
+			return
+		}
+	}
+}
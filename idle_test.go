@@ -0,0 +1,74 @@
+package valloxrs485
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestLastReceived(t *testing.T) {
+	v := newTestVallox()
+	go drainEvents(v)
+	if !v.LastReceived().IsZero() {
+		t.Errorf("expected zero time before frames")
+	}
+	v.buf.Write([]byte{0x01, 0x02})
+	handleBuffer(v)
+	if !v.LastReceived().IsZero() {
+		t.Errorf("expected invalid bytes not to update last received")
+	}
+	before := time.Now()
+	v.buf.Write(testFrame(DeviceMain, RemoteClientMulticast, FanSpeed, 0x07))
+	handleBuffer(v)
+	if v.LastReceived().Before(before) {
+		t.Errorf("expected last received to be updated by valid frame")
+	}
+}
+
+func TestIdleTimeout(t *testing.T) {
+	v := newTestVallox()
+	go drainEvents(v)
+	v.idleTimeout = 40 * time.Millisecond
+	go handleIdle(v, time.Now())
+	defer close(v.done)
+
+	select {
+	case err := <-v.errors:
+		if !errors.Is(err, ErrIdle) {
+			t.Errorf("expected idle error but got %v", err)
+		}
+	case <-time.After(time.Second):
+		t.Fatalf("no idle error reported")
+	}
+	time.Sleep(100 * time.Millisecond)
+	if len(v.errors) != 0 {
+		t.Errorf("expected idle error to be reported only once")
+	}
+
+	v.buf.Write(testFrame(DeviceMain, RemoteClientMulticast, FanSpeed, 0x07))
+	handleBuffer(v)
+	select {
+	case err := <-v.errors:
+		if !errors.Is(err, ErrIdle) {
+			t.Errorf("expected idle error but got %v", err)
+		}
+	case <-time.After(time.Second):
+		t.Fatalf("no idle error reported after bus went quiet again")
+	}
+}
+
+func TestIdleTimeoutTiny(t *testing.T) {
+	v := newTestVallox()
+	v.idleTimeout = 2 * time.Nanosecond
+	go handleIdle(v, time.Now())
+	defer close(v.done)
+
+	select {
+	case err := <-v.errors:
+		if !errors.Is(err, ErrIdle) {
+			t.Errorf("expected idle error but got %v", err)
+		}
+	case <-time.After(time.Second):
+		t.Fatalf("no idle error reported")
+	}
+}
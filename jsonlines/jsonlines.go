@@ -0,0 +1,94 @@
+// Package jsonlines streams Vallox events to TCP clients as JSON lines
+package jsonlines
+
+import (
+	"encoding/json"
+	"net"
+	"sync"
+
+	valloxrs485 "github.com/pvainio/vallox-rs485"
+)
+
+// clientBuffer is the number of events buffered for a slow client before
+// events are dropped for it
+const clientBuffer = 50
+
+// Subscriber delivers events to a callback, *valloxrs485.Vallox implements it
+type Subscriber interface {
+	SubscribeAll(fn func(valloxrs485.Event)) (unsubscribe func())
+}
+
+type server struct {
+	mutex   sync.Mutex
+	closed  bool
+	clients map[chan valloxrs485.Event]bool
+}
+
+// Serve accepts connections from ln and writes every event of vallox to
+// every connected client as a JSON line.  Events are dropped for clients
+// that do not keep up.  Serve returns when ln is closed and disconnects all
+// clients before returning.
+func Serve(ln net.Listener, vallox Subscriber) error {
+	s := &server{clients: make(map[chan valloxrs485.Event]bool)}
+	unsubscribe := vallox.SubscribeAll(s.broadcast)
+	defer s.close()
+	defer unsubscribe()
+	for {
+		conn, err := ln.Accept()
+		if err != nil {
+			return err
+		}
+		go s.handle(conn)
+	}
+}
+
+func (s *server) broadcast(e valloxrs485.Event) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	for ch := range s.clients {
+		select {
+		case ch <- e:
+		default:
+		}
+	}
+}
+
+// close disconnects all clients and refuses new ones
+func (s *server) close() {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.closed = true
+	for ch := range s.clients {
+		close(ch)
+		delete(s.clients, ch)
+	}
+}
+
+func (s *server) handle(conn net.Conn) {
+	defer conn.Close()
+	ch := make(chan valloxrs485.Event, clientBuffer)
+	s.mutex.Lock()
+	if s.closed {
+		s.mutex.Unlock()
+		return
+	}
+	s.clients[ch] = true
+	s.mutex.Unlock()
+	defer s.remove(ch)
+
+	enc := json.NewEncoder(conn)
+	for e := range ch {
+		if err := enc.Encode(e); err != nil {
+			return
+		}
+	}
+}
+
+func (s *server) remove(ch chan valloxrs485.Event) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	if s.clients[ch] {
+		delete(s.clients, ch)
+		close(ch)
+	}
+}
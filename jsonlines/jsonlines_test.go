@@ -0,0 +1,110 @@
+package jsonlines
+
+import (
+	"bufio"
+	"encoding/json"
+	"io"
+	"net"
+	"sync"
+	"testing"
+	"time"
+
+	valloxrs485 "github.com/pvainio/vallox-rs485"
+)
+
+var _ Subscriber = (*valloxrs485.Vallox)(nil)
+
+type fakeSubscriber struct {
+	mutex sync.Mutex
+	fn    func(valloxrs485.Event)
+}
+
+func (f *fakeSubscriber) SubscribeAll(fn func(valloxrs485.Event)) func() {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+	f.fn = fn
+	return func() {
+		f.mutex.Lock()
+		defer f.mutex.Unlock()
+		f.fn = nil
+	}
+}
+
+func (f *fakeSubscriber) publish(e valloxrs485.Event) {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+	if f.fn != nil {
+		f.fn(e)
+	}
+}
+
+func TestServe(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("listen failed: %v", err)
+	}
+
+	sub := &fakeSubscriber{}
+	served := make(chan error)
+	go func() { served <- Serve(ln, sub) }()
+
+	conn, err := net.Dial("tcp", ln.Addr().String())
+	if err != nil {
+		t.Fatalf("dial failed: %v", err)
+	}
+	defer conn.Close()
+
+	// Keep sending until the client has been registered and receives the event
+	stop := make(chan struct{})
+	sent := make(chan struct{})
+	go func() {
+		defer close(sent)
+		for i := 0; i < 100; i++ {
+			sub.publish(valloxrs485.Event{Register: valloxrs485.FanSpeed, Value: 3})
+			select {
+			case <-stop:
+				return
+			case <-time.After(10 * time.Millisecond):
+			}
+		}
+	}()
+
+	conn.SetReadDeadline(time.Now().Add(time.Second))
+	reader := bufio.NewReader(conn)
+	line, err := reader.ReadBytes('\n')
+	close(stop)
+	<-sent
+	if err != nil {
+		t.Fatalf("read failed: %v", err)
+	}
+	var e valloxrs485.Event
+	if err := json.Unmarshal(line, &e); err != nil {
+		t.Fatalf("invalid json %s: %v", line, err)
+	}
+	if e.Register != valloxrs485.FanSpeed || e.Value != 3 {
+		t.Errorf("unexpected event %+v", e)
+	}
+
+	ln.Close()
+	select {
+	case <-served:
+	case <-time.After(time.Second):
+		t.Fatal("Serve did not return after listener was closed")
+	}
+	sub.mutex.Lock()
+	subscribed := sub.fn != nil
+	sub.mutex.Unlock()
+	if subscribed {
+		t.Error("Serve did not unsubscribe")
+	}
+
+	// client is disconnected once buffered events have been written
+	for {
+		if _, err := reader.ReadBytes('\n'); err != nil {
+			if err != io.EOF {
+				t.Errorf("expected EOF but got %v", err)
+			}
+			break
+		}
+	}
+}
@@ -0,0 +1,29 @@
+package valloxrs485
+
+import "log"
+
+// Logger receives log messages at three levels, so that e.g. log/slog, zap
+// or zerolog can be used through a small adapter.  Warnings tell about
+// problems on the bus or in delivering data, info about changes made and
+// connection state, debug about individual frames.
+type Logger interface {
+	Debugf(format string, args ...any)
+	Infof(format string, args ...any)
+	Warnf(format string, args ...any)
+}
+
+// stdLogger writes messages of all levels to log.Logger of Config.LogDebug
+type stdLogger struct {
+	logger *log.Logger
+}
+
+func (l stdLogger) Debugf(format string, args ...any) { l.logger.Printf(format, args...) }
+func (l stdLogger) Infof(format string, args ...any)  { l.logger.Printf(format, args...) }
+func (l stdLogger) Warnf(format string, args ...any)  { l.logger.Printf(format, args...) }
+
+// nopLogger discards all messages
+type nopLogger struct{}
+
+func (nopLogger) Debugf(format string, args ...any) {}
+func (nopLogger) Infof(format string, args ...any)  {}
+func (nopLogger) Warnf(format string, args ...any)  {}
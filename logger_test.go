@@ -0,0 +1,84 @@
+package valloxrs485
+
+import (
+	"bytes"
+	"fmt"
+	"log"
+	"strings"
+	"testing"
+	"time"
+)
+
+type levelLogger struct {
+	lines []string
+}
+
+func (l *levelLogger) Debugf(format string, args ...any) { l.add("debug", format, args) }
+func (l *levelLogger) Infof(format string, args ...any)  { l.add("info", format, args) }
+func (l *levelLogger) Warnf(format string, args ...any)  { l.add("warn", format, args) }
+
+func (l *levelLogger) add(level, format string, args []any) {
+	l.lines = append(l.lines, level+" "+fmt.Sprintf(format, args...))
+}
+
+func TestLogger(t *testing.T) {
+	logger := &levelLogger{}
+	v := newTestVallox()
+	v.logger = logger
+	go drainEvents(v)
+	frame := testFrame(DeviceMain, RemoteClientMulticast, FanSpeed, 0x07)
+	v.buf.Write(append([]byte{0x01, 0x00, 0x00, 0x00, 0x00, 0x00}, frame...))
+	handleBuffer(v)
+
+	if len(logger.lines) == 0 || !strings.HasPrefix(logger.lines[0], "warn 1 checksum errors") {
+		t.Errorf("expected checksum error warning but got %q", logger.lines)
+	}
+}
+
+func TestLogDebugAdapted(t *testing.T) {
+	var logged bytes.Buffer
+	cfg := Config{LogDebug: log.New(&logged, "", 0)}
+	if err := applyDefaults(&cfg); err != nil {
+		t.Fatal(err)
+	}
+	cfg.Logger.Debugf("debug %d", 1)
+	cfg.Logger.Warnf("warn %d", 2)
+	if logged.String() != "debug 1\nwarn 2\n" {
+		t.Errorf("expected all levels written to LogDebug but got %q", logged.String())
+	}
+
+	custom := &levelLogger{}
+	cfg = Config{LogDebug: log.New(&logged, "", 0), Logger: custom}
+	applyDefaults(&cfg)
+	if cfg.Logger != Logger(custom) {
+		t.Errorf("expected Logger to take precedence over LogDebug")
+	}
+}
+
+func TestPrepareOpenWarnsBaud(t *testing.T) {
+	logger := &levelLogger{}
+	cfg := Config{Baud: 19200, Logger: logger}
+	if err := prepareOpen(&cfg); err != nil {
+		t.Fatal(err)
+	}
+	if len(logger.lines) != 1 || !strings.HasPrefix(logger.lines[0], "warn requested baud 19200") {
+		t.Errorf("expected baud warning but got %q", logger.lines)
+	}
+}
+
+func TestChecksumWarningsRateLimited(t *testing.T) {
+	logger := &levelLogger{}
+	v := newTestVallox()
+	v.logger = logger
+	now := time.Now()
+	v.warnChecksumErrors(1, now)
+	v.warnChecksumErrors(2, now.Add(time.Second))
+	v.warnChecksumErrors(0, now.Add(2*time.Second))
+	v.warnChecksumErrors(3, now.Add(checksumWarnInterval))
+	v.warnChecksumErrors(0, now.Add(3*checksumWarnInterval))
+
+	expected := []string{"warn 1 checksum errors in received data", "warn 5 checksum errors in received data"}
+	if strings.Join(logger.lines, "\n") != strings.Join(expected, "\n") {
+		t.Errorf("expected warnings %q but got %q", expected, logger.lines)
+	}
+}
@@ -0,0 +1,94 @@
+package valloxrs485
+
+import "fmt"
+
+// registerNames contains names of the known registers
+var registerNames = map[byte]string{
+	FanSpeed:               "FanSpeed",
+	FanSpeedMax:            "FanSpeedMax",
+	FanSpeedMin:            "FanSpeedMin",
+	TempIncomingOutside:    "TempIncomingOutside",
+	TempOutgoingInside:     "TempOutgoingInside",
+	TempIncomingInside:     "TempIncomingInside",
+	TempOutgoingOutside:    "TempOutgoingOutside",
+	TempIncomingOutsideNew: "TempIncomingOutsideNew",
+	TempOutgoingInsideNew:  "TempOutgoingInsideNew",
+	TempIncomingInsideNew:  "TempIncomingInsideNew",
+	TempOutgoingOutsideNew: "TempOutgoingOutsideNew",
+	HeatingTarget:          "HeatingTarget",
+	HumidityLimit:          "HumidityLimit",
+	BypassTemp:             "BypassTemp",
+	ServiceInterval:        "ServiceInterval",
+	ServiceRemaining:       "ServiceRemaining",
+	FaultCode:              "FaultCode",
+	Preheating:             "Preheating",
+	SelectRegister:         "SelectRegister",
+	Flags6:                 "Flags6",
+	SupplyFanPercent:       "SupplyFanPercent",
+	ExtractFanPercent:      "ExtractFanPercent",
+	Co2TargetHighByte:      "Co2TargetHighByte",
+	Co2TargetLowByte:       "Co2TargetLowByte",
+	RhHighest:              "RhHighest",
+	Co2HighestHighByte:     "Co2HighestHighByte",
+	Co2HighestLowByte:      "Co2HighestLowByte",
+	Rh1:                    "Rh1",
+	Rh2:                    "Rh2",
+}
+
+// deviceNames contains names of the well known addresses
+var deviceNames = map[byte]string{
+	DeviceMulticast:       "DeviceMulticast",
+	DeviceMain:            "DeviceMain",
+	DeviceSecondary:       "DeviceSecondary",
+	RemoteClientMulticast: "RemoteClientMulticast",
+}
+
+// registerUnits contains units of decoded values, temperatures are in Celsius
+var registerUnits = map[byte]string{
+	RhHighest:         "%RH",
+	Rh1:               "%RH",
+	Rh2:               "%RH",
+	HumidityLimit:     "%RH",
+	Co2HighestLowByte: "ppm",
+	Co2TargetLowByte:  "ppm",
+	SupplyFanPercent:  "%",
+	ExtractFanPercent: "%",
+	ServiceInterval:   "months",
+	ServiceRemaining:  "months",
+}
+
+// RegisterName returns name of the register, or its number in hex if unknown
+func RegisterName(r byte) string {
+	if name, found := registerNames[r]; found {
+		return name
+	}
+	return fmt.Sprintf("0x%02x", r)
+}
+
+func deviceName(address byte) string {
+	if name, found := deviceNames[address]; found {
+		return name
+	}
+	return fmt.Sprintf("0x%02x", address)
+}
+
+func registerUnit(r byte) string {
+	if temperatureRegisters[r] {
+		return "°C"
+	}
+	return registerUnits[r]
+}
+
+// String returns the event in human readable form, e.g.
+// "DeviceMain -> RemoteClientMulticast TempIncomingOutside = -2 °C (raw 0x5f)".
+// Queries are shown with the queried register.
+func (e Event) String() string {
+	if e.Register == 0 {
+		return fmt.Sprintf("%s -> %s query %s", deviceName(e.Source), deviceName(e.Destination), RegisterName(e.RawValue))
+	}
+	value := fmt.Sprint(e.Value)
+	if unit := registerUnit(e.Register); unit != "" {
+		value += " " + unit
+	}
+	return fmt.Sprintf("%s -> %s %s = %s (raw 0x%02x)", deviceName(e.Source), deviceName(e.Destination), RegisterName(e.Register), value, e.RawValue)
+}
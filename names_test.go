@@ -0,0 +1,26 @@
+package valloxrs485
+
+import "testing"
+
+func TestRegisterName(t *testing.T) {
+	for r, expected := range map[byte]string{TempIncomingOutside: "TempIncomingOutside", FanSpeed: "FanSpeed", 0xf0: "0xf0"} {
+		if name := RegisterName(r); name != expected {
+			t.Errorf("expected name %s for %x but got %s", expected, r, name)
+		}
+	}
+}
+
+func TestEventString(t *testing.T) {
+	tests := map[string]Event{
+		"DeviceMain -> RemoteClientMulticast TempIncomingOutside = -2 °C (raw 0x5f)": {Source: DeviceMain, Destination: RemoteClientMulticast, Register: TempIncomingOutside, RawValue: 0x5f, Value: -2},
+		"DeviceMain -> 0x27 FanSpeed = 3 (raw 0x07)":                                 {Source: DeviceMain, Destination: 0x27, Register: FanSpeed, RawValue: 0x07, Value: 3},
+		"DeviceMain -> 0x27 Rh1 = 50 %RH (raw 0x99)":                                 {Source: DeviceMain, Destination: 0x27, Register: Rh1, RawValue: 0x99, Value: 50},
+		"0x21 -> DeviceMain query Co2HighestLowByte":                                 {Source: 0x21, Destination: DeviceMain, Register: 0, RawValue: Co2HighestLowByte, Value: 0x2c},
+		"DeviceMain -> 0x27 0xf0 = 1 (raw 0x01)":                                     {Source: DeviceMain, Destination: 0x27, Register: 0xf0, RawValue: 1, Value: 1},
+	}
+	for expected, e := range tests {
+		if s := e.String(); s != expected {
+			t.Errorf("expected %q but got %q", expected, s)
+		}
+	}
+}
@@ -0,0 +1,53 @@
+package valloxrs485
+
+// OverflowPolicy defines what happens to an event when the Events channel
+// is full because the consumer does not keep up
+type OverflowPolicy int
+
+const (
+	// OverflowBlock waits until the consumer reads the channel.  Reading
+	// from the device stops meanwhile, so a stalled consumer can make the
+	// device buffer overflow and frames get lost.
+	OverflowBlock OverflowPolicy = iota
+	// OverflowDropNewest drops the event that does not fit in the channel
+	OverflowDropNewest
+	// OverflowDropOldest drops the oldest event in the channel to make room
+	// for the new one
+	OverflowDropOldest
+)
+
+// deliver sends event to Events channel according to the overflow policy,
+// dropped events are counted in Stats.DroppedEvents
+func (vallox *Vallox) deliver(e Event) {
+	switch vallox.onEventOverflow {
+	case OverflowDropNewest:
+		select {
+		case vallox.in <- e:
+		default:
+			vallox.dropEvent(e)
+		}
+	case OverflowDropOldest:
+		for {
+			select {
+			case vallox.in <- e:
+				return
+			default:
+			}
+			select {
+			case old := <-vallox.in:
+				vallox.dropEvent(old)
+			default:
+			}
+		}
+	default:
+		select {
+		case vallox.in <- e:
+		case <-vallox.done:
+		}
+	}
+}
+
+func (vallox *Vallox) dropEvent(e Event) {
+	vallox.counters.droppedEvents.Add(1)
+	vallox.logger.Warnf("events channel full, dropped event from %x register %x", e.Source, e.Register)
+}
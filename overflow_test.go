@@ -0,0 +1,61 @@
+package valloxrs485
+
+import "testing"
+
+func fillEvents(v *Vallox, values ...byte) {
+	for _, value := range values {
+		handlePackage(&Package{Source: DeviceMain, Destination: RemoteClientMulticast, Register: FanSpeed, Value: value}, v)
+	}
+}
+
+func TestOverflowDropNewest(t *testing.T) {
+	v := newTestVallox()
+	v.in = make(chan Event, 2)
+	v.onEventOverflow = OverflowDropNewest
+
+	fillEvents(v, 0x01, 0x03, 0x07)
+
+	if dropped := v.Stats().DroppedEvents; dropped != 1 {
+		t.Errorf("expected 1 dropped event but got %d", dropped)
+	}
+	for _, expected := range []int16{1, 2} {
+		if e := <-v.in; e.Value != expected {
+			t.Errorf("expected speed %d but got %d", expected, e.Value)
+		}
+	}
+}
+
+func TestOverflowDropOldest(t *testing.T) {
+	v := newTestVallox()
+	v.in = make(chan Event, 2)
+	v.onEventOverflow = OverflowDropOldest
+
+	fillEvents(v, 0x01, 0x03, 0x07, 0x0f)
+
+	if dropped := v.Stats().DroppedEvents; dropped != 2 {
+		t.Errorf("expected 2 dropped events but got %d", dropped)
+	}
+	for _, expected := range []int16{3, 4} {
+		if e := <-v.in; e.Value != expected {
+			t.Errorf("expected speed %d but got %d", expected, e.Value)
+		}
+	}
+}
+
+func TestOverflowBlockReleasedByClose(t *testing.T) {
+	v := newTestVallox()
+	v.in = make(chan Event, 1)
+
+	fillEvents(v, 0x01)
+	delivered := make(chan struct{})
+	go func() {
+		fillEvents(v, 0x03)
+		close(delivered)
+	}()
+	close(v.done)
+	<-delivered
+
+	if dropped := v.Stats().DroppedEvents; dropped != 0 {
+		t.Errorf("expected no dropped events but got %d", dropped)
+	}
+}
@@ -0,0 +1,58 @@
+package valloxrs485
+
+import (
+	"sync"
+	"time"
+)
+
+// minPollSlot is the shortest time between poll queries, roughly the time a
+// query and its response take on the bus
+const minPollSlot = 10 * time.Millisecond
+
+// Poll queries registers from the main device repeatedly so that each
+// register is queried once per interval.  Queries are spread evenly over the
+// interval instead of sent all at once.  CO2 values are polled with their
+// low byte registers like in QueryValues.  Responses are received as
+// events.  A query is skipped if the register has been received within the
+// interval, e.g. because the unit broadcasts it, to save bus bandwidth.
+// Queries are sent at most once per 10ms, so a short interval with many
+// registers polls each register less often than requested.  Polling stops
+// on Close or when the returned function is called.
+func (vallox *Vallox) Poll(registers []byte, interval time.Duration) (stop func()) {
+	stopped := make(chan struct{})
+	var once sync.Once
+	stop = func() {
+		once.Do(func() { close(stopped) })
+	}
+	if len(registers) == 0 || interval <= 0 {
+		vallox.logger.Debugf("nothing to poll with interval %v", interval)
+		return stop
+	}
+	slot := interval / time.Duration(len(registers))
+	if slot < minPollSlot {
+		slot = minPollSlot
+	}
+	go vallox.poll(append([]byte(nil), registers...), interval, slot, stopped)
+	return stop
+}
+
+// poll queries one register per slot in turn until stopped, registers
+// received within interval are not queried
+func (vallox *Vallox) poll(registers []byte, interval, slot time.Duration, stopped chan struct{}) {
+	ticker := time.NewTicker(slot)
+	defer ticker.Stop()
+	for i := 0; ; i = (i + 1) % len(registers) {
+		if e, found := vallox.LastValue(registers[i]); found && time.Since(e.Time) < interval {
+			vallox.logger.Debugf("skipping poll of register %x received %v ago", registers[i], time.Since(e.Time))
+		} else if err := vallox.queryPair(registers[i]); err != nil {
+			vallox.logger.Warnf("poll: %v", err)
+		}
+		select {
+		case <-ticker.C:
+		case <-stopped:
+			return
+		case <-vallox.done:
+			return
+		}
+	}
+}
@@ -0,0 +1,74 @@
+package valloxrs485
+
+import (
+	"bytes"
+	"testing"
+	"time"
+)
+
+// polledRegisters returns registers queried by v during d
+func polledRegisters(v *Vallox, d time.Duration) []byte {
+	var queried []byte
+	timeout := time.After(d)
+	for {
+		select {
+		case o := <-v.out:
+			queried = append(queried, o.pkg.Value)
+		case <-timeout:
+			return queried
+		}
+	}
+}
+
+func TestPoll(t *testing.T) {
+	v := newTestVallox()
+	stop := v.Poll([]byte{FanSpeed, Co2HighestLowByte}, 40*time.Millisecond)
+
+	queried := polledRegisters(v, 70*time.Millisecond)
+	expected := []byte{FanSpeed, Co2HighestHighByte, Co2HighestLowByte, FanSpeed}
+	if len(queried) < len(expected) || !bytes.Equal(queried[:len(expected)], expected) {
+		t.Errorf("expected queries to start with %x but got %x", expected, queried)
+	}
+
+	stop()
+	stop()
+	polledRegisters(v, 30*time.Millisecond)
+	if queried := polledRegisters(v, 50*time.Millisecond); len(queried) != 0 {
+		t.Errorf("expected no queries after stop but got %x", queried)
+	}
+}
+
+func TestPollSkipsFreshRegisters(t *testing.T) {
+	v := newTestVallox()
+	v.cache.put(Event{Time: time.Now(), Register: FanSpeed, Value: 3})
+	v.cache.put(Event{Time: time.Now().Add(-time.Second), Register: Rh1, Value: 40})
+	stop := v.Poll([]byte{FanSpeed, Rh1}, 100*time.Millisecond)
+	defer stop()
+
+	if queried := polledRegisters(v, 80*time.Millisecond); !bytes.Equal(queried, []byte{Rh1}) {
+		t.Errorf("expected only stale register %x to be queried but got %x", Rh1, queried)
+	}
+}
+
+func TestPollStopsOnClose(t *testing.T) {
+	v := newTestVallox()
+	v.Poll([]byte{FanSpeed}, 10*time.Millisecond)
+	polledRegisters(v, 15*time.Millisecond)
+	close(v.done)
+	polledRegisters(v, 20*time.Millisecond)
+	if queried := polledRegisters(v, 30*time.Millisecond); len(queried) != 0 {
+		t.Errorf("expected no queries after close but got %x", queried)
+	}
+}
+
+func TestPollShortInterval(t *testing.T) {
+	v := newTestVallox()
+	stop := v.Poll([]byte{FanSpeed, Rh1, Rh2}, time.Nanosecond)
+	defer stop()
+
+	// queries are spaced by the minimum slot
+	queried := polledRegisters(v, 45*time.Millisecond)
+	if len(queried) < 2 || len(queried) > 6 {
+		t.Errorf("expected queries spaced by %v but got %x", minPollSlot, queried)
+	}
+}
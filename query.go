@@ -0,0 +1,422 @@
+package valloxrs485
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// FanSettings contains current fan speed and configured limits
+type FanSettings struct {
+	// Time of the latest received value
+	Time          time.Time
+	Speed         int16
+	SpeedValid    bool
+	MaxSpeed      int16
+	MaxSpeedValid bool
+	MinSpeed      int16
+	MinSpeedValid bool
+}
+
+// FanSettings queries fan speed and its max and min limits.  Fields that
+// did not receive a response before ctx expired are marked as not valid.
+// Error is returned only if none of the registers responded.
+func (vallox *Vallox) FanSettings(ctx context.Context) (FanSettings, error) {
+	var settings FanSettings
+	values, err := vallox.QueryValues(ctx, FanSpeed, FanSpeedMax, FanSpeedMin)
+	if len(values) == 0 {
+		return settings, err
+	}
+	for _, e := range values {
+		if e.Time.After(settings.Time) {
+			settings.Time = e.Time
+		}
+	}
+	settings.Speed, settings.SpeedValid = eventValue(values, FanSpeed)
+	settings.MaxSpeed, settings.MaxSpeedValid = eventValue(values, FanSpeedMax)
+	settings.MinSpeed, settings.MinSpeedValid = eventValue(values, FanSpeedMin)
+	return settings, nil
+}
+
+// FilterStatus contains service reminder (filter change) status
+type FilterStatus struct {
+	// Time of the latest received value
+	Time            time.Time
+	IntervalMonths  int16
+	IntervalValid   bool
+	RemainingMonths int16
+	RemainingValid  bool
+	// RemainingPercent is the remaining time as percentage of the interval
+	RemainingPercent int16
+	PercentValid     bool
+}
+
+// FilterStatus queries service reminder interval and remaining months.
+// Fields that did not receive a response before ctx expired are marked as
+// not valid.  Error is returned only if none of the registers responded.
+func (vallox *Vallox) FilterStatus(ctx context.Context) (FilterStatus, error) {
+	var status FilterStatus
+	values, err := vallox.QueryValues(ctx, ServiceInterval, ServiceRemaining)
+	if len(values) == 0 {
+		return status, err
+	}
+	for _, e := range values {
+		if e.Time.After(status.Time) {
+			status.Time = e.Time
+		}
+	}
+	status.IntervalMonths, status.IntervalValid = eventValue(values, ServiceInterval)
+	status.RemainingMonths, status.RemainingValid = eventValue(values, ServiceRemaining)
+	if status.IntervalValid && status.RemainingValid && status.IntervalMonths > 0 {
+		status.RemainingPercent = status.RemainingMonths * 100 / status.IntervalMonths
+		status.PercentValid = true
+	}
+	return status, nil
+}
+
+// Preheating queries if intake air preheating is on
+func (vallox *Vallox) Preheating(ctx context.Context) (bool, error) {
+	values, err := vallox.QueryValues(ctx, Preheating)
+	if err != nil {
+		return false, err
+	}
+	return values[Preheating].Value == 1, nil
+}
+
+// HeatingTarget queries the supply air temperature target in Celsius
+func (vallox *Vallox) HeatingTarget(ctx context.Context) (int16, error) {
+	return vallox.queryValue(ctx, HeatingTarget)
+}
+
+// HumidityLimit queries humidity level in %RH above which fan speed is increased
+func (vallox *Vallox) HumidityLimit(ctx context.Context) (int16, error) {
+	return vallox.queryValue(ctx, HumidityLimit)
+}
+
+// BypassTemp queries outdoor temperature in Celsius above which heat recovery is bypassed
+func (vallox *Vallox) BypassTemp(ctx context.Context) (int16, error) {
+	return vallox.queryValue(ctx, BypassTemp)
+}
+
+func (vallox *Vallox) queryValue(ctx context.Context, register byte) (int16, error) {
+	e, err := vallox.Get(ctx, register)
+	return e.Value, err
+}
+
+// Get queries register from the main device and waits for the response
+// addressed to this client.  Events from other devices and echoes of own
+// frames are ignored.  Concurrent calls for the same register each send a
+// query and receive the first response.
+func (vallox *Vallox) Get(ctx context.Context, register byte) (Event, error) {
+	values, err := vallox.QueryValues(ctx, register)
+	if err != nil {
+		return Event{}, err
+	}
+	return values[register], nil
+}
+
+func eventValue(values map[byte]Event, register byte) (int16, bool) {
+	e, ok := values[register]
+	return e.Value, ok
+}
+
+// QueryValues queries given registers and waits for responses until all
+// registers have responded or ctx expires.  Values received before ctx
+// expired are returned together with the context error.  CO2 values are
+// queried with their low byte registers, e.g. Co2HighestLowByte, high byte
+// is queried automatically before it.  All queries must fit in the outgoing
+// queue of 50 frames, otherwise ErrQueueFull is returned before anything is
+// queued.  Only responses from main devices are accepted.
+func (vallox *Vallox) QueryValues(ctx context.Context, registers ...byte) (map[byte]Event, error) {
+	waiters := make(map[byte]chan Event, len(registers))
+	queries := make([]byte, 0, len(registers)+1)
+	for _, r := range registers {
+		if _, found := waiters[r]; !found {
+			// room for events of other sources preceding the response
+			waiters[r] = vallox.addWaiterSize(r, 16)
+			if high, found := co2HighBytes[r]; found {
+				queries = append(queries, high)
+			}
+			queries = append(queries, r)
+		}
+	}
+	defer func() {
+		for r, ch := range waiters {
+			vallox.removeWaiter(r, ch)
+		}
+	}()
+
+	if free := cap(vallox.out) - len(vallox.out); len(queries) > free {
+		return map[byte]Event{}, fmt.Errorf("%w: %d queries, room for %d", ErrQueueFull, len(queries), free)
+	}
+	for _, r := range queries {
+		if err := vallox.Query(r); err != nil {
+			return map[byte]Event{}, err
+		}
+	}
+
+	values := make(map[byte]Event, len(waiters))
+	for r, ch := range waiters {
+		for received := false; !received; {
+			select {
+			case e := <-ch:
+				if IsMainDevice(e.Source) {
+					values[r], received = e, true
+				}
+			case <-ctx.Done():
+				collectReceived(waiters, values)
+				return values, ctx.Err()
+			}
+		}
+	}
+	return values, nil
+}
+
+// collectReceived adds responses of main devices already received but not
+// yet collected
+func collectReceived(waiters map[byte]chan Event, values map[byte]Event) {
+	for r, ch := range waiters {
+		for pending := true; pending; {
+			select {
+			case e := <-ch:
+				if IsMainDevice(e.Source) {
+					values[r], pending = e, false
+				}
+			default:
+				pending = false
+			}
+		}
+	}
+}
+
+// GetOrQuery returns the latest value of register if it was received within
+// maxAge, otherwise queries the register and waits for the response
+func (vallox *Vallox) GetOrQuery(ctx context.Context, register byte, maxAge time.Duration) (Event, error) {
+	if e, found := vallox.LastValue(register); found && time.Since(e.Time) <= maxAge {
+		return e, nil
+	}
+	return vallox.Get(ctx, register)
+}
+
+// currentSpeedMaxAge is how old cached fan speed CurrentSpeed returns
+const currentSpeedMaxAge = time.Minute
+
+// CurrentSpeed returns current fan speed 1-8.  Speed received within a
+// minute is returned from cache, otherwise it is queried.
+func (vallox *Vallox) CurrentSpeed(ctx context.Context) (byte, error) {
+	e, err := vallox.GetOrQuery(ctx, FanSpeed, currentSpeedMaxAge)
+	if err != nil {
+		return 0, err
+	}
+	return byte(e.Value), nil
+}
+
+// QueryMulticastValues queries register from all remote clients and collects
+// responses by source address until ctx expires
+func (vallox *Vallox) QueryMulticastValues(ctx context.Context, register byte) map[byte]Event {
+	ch := vallox.addWaiterSize(register, 16)
+	defer vallox.removeWaiter(register, ch)
+	if err := vallox.QueryMulticast(register); err != nil {
+		vallox.logger.Warnf("multicast query: %v", err)
+		return map[byte]Event{}
+	}
+
+	values := make(map[byte]Event)
+	for {
+		select {
+		case e := <-ch:
+			values[e.Source] = e
+		case <-ctx.Done():
+			return values
+		}
+	}
+}
+
+// SetSpeedVerified sets fan speed and verifies that the main device and
+// given remote clients report the new speed when queried.  The speed is
+// written like SetSpeed, so with Config.DisableSpeedMulticast it is not sent
+// to remote clients and they report the new speed only after the main device
+// has broadcast it.  Verifying remotes then fails if they are queried before
+// that.
+func (vallox *Vallox) SetSpeedVerified(ctx context.Context, speed byte, remotes ...byte) error {
+	if err := vallox.SetSpeed(speed); err != nil {
+		return err
+	}
+	for _, device := range append([]byte{DeviceMain}, remotes...) {
+		e, err := vallox.queryFrom(ctx, device, FanSpeed)
+		if err != nil {
+			return fmt.Errorf("verifying speed from %x: %w", device, err)
+		}
+		if e.Value != int16(speed) {
+			return fmt.Errorf("device %x reports speed %d, expected %d", device, e.Value, speed)
+		}
+	}
+	return nil
+}
+
+// setSpeedAttempts is the number of times SetSpeedConfirmed writes the speed
+const setSpeedAttempts = 3
+
+// SetSpeedConfirmed sets fan speed and reads it back from the main device.
+// The speed is written again, up to three times in total, while the main
+// device reports a different speed.  If another remote client, e.g. the
+// panel, changes the speed meanwhile, its change is accepted as the latest
+// one and nil is returned.
+func (vallox *Vallox) SetSpeedConfirmed(ctx context.Context, speed byte) error {
+	others := vallox.subscriptions.add(func(e Event) bool {
+		return e.Register == FanSpeed && e.Source > RemoteClientMulticast && e.Source <= 0x2f &&
+			e.Source != vallox.remoteClientId && (IsMainDevice(e.Destination) || e.Destination == DeviceMulticast)
+	})
+	defer vallox.subscriptions.remove(others)
+
+	var reported int16
+	for attempt := 1; attempt <= setSpeedAttempts; attempt++ {
+		if err := vallox.SetSpeed(speed); err != nil {
+			return err
+		}
+		// only the main device confirms, not echoes of our own multicast
+		e, err := vallox.queryFrom(ctx, DeviceMain, FanSpeed)
+		if err != nil {
+			return fmt.Errorf("confirming speed: %w", err)
+		}
+		if e.Value == int16(speed) {
+			return nil
+		}
+		select {
+		case e := <-others:
+			vallox.logger.Infof("speed changed to %d by %x while setting %d", e.Value, e.Source, speed)
+			return nil
+		default:
+		}
+		reported = e.Value
+		vallox.logger.Infof("main device reports speed %d after attempt %d to set %d", reported, attempt, speed)
+	}
+	return fmt.Errorf("main device reports speed %d, expected %d", reported, speed)
+}
+
+// queryPair queries register, for CO2 low byte registers the high byte
+// register is queried first
+func (vallox *Vallox) queryPair(register byte) error {
+	if high, found := co2HighBytes[register]; found {
+		if err := vallox.Query(high); err != nil {
+			return err
+		}
+	}
+	return vallox.Query(register)
+}
+
+// queryFrom queries register from device and waits for its response
+func (vallox *Vallox) queryFrom(ctx context.Context, device byte, register byte) (Event, error) {
+	ch := vallox.addWaiterSize(register, 16)
+	defer vallox.removeWaiter(register, ch)
+	if err := vallox.QueryDevice(device, register); err != nil {
+		return Event{}, err
+	}
+	for {
+		select {
+		case e := <-ch:
+			if e.Source == device {
+				return e, nil
+			}
+		case <-ctx.Done():
+			return Event{}, ctx.Err()
+		}
+	}
+}
+
+// QueryRaw queries register and returns the raw value of the response
+// without decoding it
+func (vallox *Vallox) QueryRaw(ctx context.Context, register byte) (byte, error) {
+	ch := vallox.rawWaiters.add(register, 1)
+	defer vallox.rawWaiters.remove(register, ch)
+	if err := vallox.Query(register); err != nil {
+		return 0, err
+	}
+	select {
+	case e := <-ch:
+		return e.RawValue, nil
+	case <-ctx.Done():
+		return 0, ctx.Err()
+	}
+}
+
+// waiters are keyed by the register of events, so that queries of old
+// temperature registers receive normalized responses
+func (vallox *Vallox) addWaiter(register byte) chan Event {
+	return vallox.waiters.add(vallox.eventRegister(register), 1)
+}
+
+func (vallox *Vallox) addWaiterSize(register byte, size int) chan Event {
+	return vallox.waiters.add(vallox.eventRegister(register), size)
+}
+
+func (vallox *Vallox) removeWaiter(register byte, ch chan Event) {
+	vallox.waiters.remove(vallox.eventRegister(register), ch)
+}
+
+// notifyWaiters passes event to everyone waiting for the register, never blocking
+func (vallox *Vallox) notifyWaiters(e Event) {
+	if vallox.ForMe(e) {
+		vallox.waiters.notify(e)
+	}
+}
+
+// notifyRawWaiters passes undecoded package to everyone waiting for the register
+func (vallox *Vallox) notifyRawWaiters(pkg *Package) {
+	e := Event{
+		Time:        time.Now(),
+		Source:      pkg.Source,
+		Destination: pkg.Destination,
+		Register:    pkg.Register,
+		RawValue:    pkg.Value,
+		Value:       int16(pkg.Value),
+	}
+	if vallox.ForMe(e) {
+		vallox.rawWaiters.notify(e)
+	}
+}
+
+// waiters keeps channels waiting for events of a register
+type waiters struct {
+	mutex    sync.Mutex
+	channels map[byte][]chan Event
+}
+
+func (w *waiters) add(register byte, size int) chan Event {
+	ch := make(chan Event, size)
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+	if w.channels == nil {
+		w.channels = make(map[byte][]chan Event)
+	}
+	w.channels[register] = append(w.channels[register], ch)
+	return ch
+}
+
+func (w *waiters) remove(register byte, ch chan Event) {
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+	channels := w.channels[register]
+	for i, c := range channels {
+		if c == ch {
+			w.channels[register] = append(channels[:i], channels[i+1:]...)
+			break
+		}
+	}
+	if len(w.channels[register]) == 0 {
+		delete(w.channels, register)
+	}
+}
+
+// notify passes event to everyone waiting for the register, never blocking
+func (w *waiters) notify(e Event) {
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+	for _, ch := range w.channels[e.Register] {
+		select {
+		case ch <- e:
+		default:
+		}
+	}
+}
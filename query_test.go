@@ -0,0 +1,485 @@
+package valloxrs485
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestFanSettings(t *testing.T) {
+	v := newTestVallox()
+	v.remoteClientId = 0x27
+	go respond(v, map[byte]byte{FanSpeed: 0x07, FanSpeedMax: 0xff})
+
+	ctx, cancel := context.WithTimeout(context.Background(), 200*time.Millisecond)
+	defer cancel()
+	settings, err := v.FanSettings(ctx)
+	if err != nil {
+		t.Fatalf("expected no error but got %v", err)
+	}
+	if !settings.SpeedValid || settings.Speed != 3 {
+		t.Errorf("expected speed 3 but got %d valid %v", settings.Speed, settings.SpeedValid)
+	}
+	if !settings.MaxSpeedValid || settings.MaxSpeed != 8 {
+		t.Errorf("expected max speed 8 but got %d valid %v", settings.MaxSpeed, settings.MaxSpeedValid)
+	}
+	if settings.MinSpeedValid {
+		t.Errorf("expected min speed not to be valid")
+	}
+}
+
+func TestFanSettingsNoResponse(t *testing.T) {
+	v := newTestVallox()
+	v.remoteClientId = 0x27
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	if _, err := v.FanSettings(ctx); err == nil {
+		t.Errorf("expected error when nothing responds")
+	}
+}
+
+func TestQueryValues(t *testing.T) {
+	v := newTestVallox()
+	v.remoteClientId = 0x27
+	go respond(v, map[byte]byte{Rh1: 0x99, Rh2: 0xff})
+
+	ctx, cancel := context.WithTimeout(context.Background(), 200*time.Millisecond)
+	defer cancel()
+	values, err := v.QueryValues(ctx, Rh1, Rh2)
+	if err != nil {
+		t.Fatalf("expected no error but got %v", err)
+	}
+	if values[Rh1].Value != 50 || values[Rh2].Value != 100 {
+		t.Errorf("unexpected values %+v", values)
+	}
+
+	ctx, cancel = context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	values, err = v.QueryValues(ctx, Rh1, RhHighest)
+	if err == nil {
+		t.Errorf("expected error when a register does not respond")
+	}
+	if _, ok := values[Rh1]; !ok || len(values) != 1 {
+		t.Errorf("expected partial values but got %+v", values)
+	}
+}
+
+// respond answers queries sent by v with given register values as the main device would
+func respond(v *Vallox, values map[byte]byte) {
+	respondDevices(v, map[byte]map[byte]byte{DeviceMain: values})
+}
+
+// respondDevices answers queries sent by v to each device with given register values
+func respondDevices(v *Vallox, devices map[byte]map[byte]byte) {
+	for o := range v.out {
+		pkg := o.pkg
+		if pkg.Register != 0 {
+			continue
+		}
+		if value, ok := devices[pkg.Destination][pkg.Value]; ok {
+			reply := Package{System: 1, Source: pkg.Destination, Destination: pkg.Source, Register: pkg.Value, Value: value}
+			handlePackage(&reply, v)
+		}
+	}
+}
+
+func TestGetIgnoresOtherSources(t *testing.T) {
+	v := newTestVallox()
+	v.remoteClientId = 0x27
+	go drainEvents(v)
+	go func() {
+		pkg := (<-v.out).pkg
+		// a remote client and own echo answer before the main device
+		handlePackage(&Package{System: 1, Source: 0x21, Destination: 0x27, Register: pkg.Value, Value: 0x0f}, v)
+		handlePackage(&Package{System: 1, Source: 0x27, Destination: RemoteClientMulticast, Register: pkg.Value, Value: 0x0f}, v)
+		handlePackage(&Package{System: 1, Source: DeviceMain, Destination: 0x27, Register: pkg.Value, Value: 0x07}, v)
+	}()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 200*time.Millisecond)
+	defer cancel()
+	if e, err := v.Get(ctx, FanSpeed); err != nil || e.Source != DeviceMain || e.Value != 3 {
+		t.Errorf("expected speed 3 from main device but got %+v, %v", e, err)
+	}
+}
+
+func TestGetNormalizedTempRegister(t *testing.T) {
+	v := newTestVallox()
+	v.remoteClientId = 0x27
+	v.normalize = true
+	go drainEvents(v)
+	go respond(v, map[byte]byte{TempIncomingOutside: 0x80})
+
+	ctx, cancel := context.WithTimeout(context.Background(), 200*time.Millisecond)
+	defer cancel()
+	e, err := v.Get(ctx, TempIncomingOutside)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if e.Register != TempIncomingOutsideNew || e.Value != tempConversion[0x80] {
+		t.Errorf("expected normalized temperature but got %+v", e)
+	}
+	if last, found := v.LastValue(TempIncomingOutside); !found || last.Value != e.Value {
+		t.Errorf("expected last value by old register but got %+v", last)
+	}
+}
+
+func TestHeatingTarget(t *testing.T) {
+	v := newTestVallox()
+	v.remoteClientId = 0x27
+	go respond(v, map[byte]byte{HeatingTarget: 160})
+
+	ctx, cancel := context.WithTimeout(context.Background(), 200*time.Millisecond)
+	defer cancel()
+	if target, err := v.HeatingTarget(ctx); err != nil || target != 20 {
+		t.Errorf("expected heating target 20 but got %d, %v", target, err)
+	}
+}
+
+func TestFilterStatus(t *testing.T) {
+	v := newTestVallox()
+	v.remoteClientId = 0x27
+	go respond(v, map[byte]byte{ServiceInterval: 4, ServiceRemaining: 1})
+
+	ctx, cancel := context.WithTimeout(context.Background(), 200*time.Millisecond)
+	defer cancel()
+	status, err := v.FilterStatus(ctx)
+	if err != nil {
+		t.Fatalf("expected no error but got %v", err)
+	}
+	if !status.IntervalValid || status.IntervalMonths != 4 || !status.RemainingValid || status.RemainingMonths != 1 {
+		t.Errorf("unexpected status %+v", status)
+	}
+	if !status.PercentValid || status.RemainingPercent != 25 {
+		t.Errorf("expected 25%% remaining but got %+v", status)
+	}
+}
+
+func TestFilterStatusPartial(t *testing.T) {
+	v := newTestVallox()
+	v.remoteClientId = 0x27
+	go respond(v, map[byte]byte{ServiceRemaining: 1})
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	status, err := v.FilterStatus(ctx)
+	if err != nil {
+		t.Fatalf("expected no error but got %v", err)
+	}
+	if status.IntervalValid || status.PercentValid || !status.RemainingValid {
+		t.Errorf("unexpected status %+v", status)
+	}
+}
+
+func TestQueryMulticastValues(t *testing.T) {
+	v := newTestVallox()
+	v.remoteClientId = 0x27
+	go func() {
+		pkg := (<-v.out).pkg
+		if pkg.Destination != RemoteClientMulticast || pkg.Value != FanSpeed {
+			t.Errorf("unexpected query %+v", pkg)
+		}
+		for _, remote := range []byte{0x21, 0x22} {
+			handlePackage(&Package{Source: remote, Destination: 0x27, Register: FanSpeed, Value: 0x07}, v)
+		}
+	}()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	values := v.QueryMulticastValues(ctx, FanSpeed)
+	if len(values) != 2 || values[0x21].Value != 3 || values[0x22].Value != 3 {
+		t.Errorf("expected responses from two remotes but got %+v", values)
+	}
+}
+
+func TestPreheating(t *testing.T) {
+	v := newTestVallox()
+	v.remoteClientId = 0x27
+	go respond(v, map[byte]byte{Preheating: 0x81})
+
+	ctx, cancel := context.WithTimeout(context.Background(), 200*time.Millisecond)
+	defer cancel()
+	if on, err := v.Preheating(ctx); err != nil || !on {
+		t.Errorf("expected preheating on but got %v, %v", on, err)
+	}
+}
+
+func TestSetSpeedVerified(t *testing.T) {
+	v := newTestVallox()
+	v.writeAllowed = true
+	v.remoteClientId = 0x27
+	go drainEvents(v)
+	go respondDevices(v, map[byte]map[byte]byte{
+		DeviceMain: {FanSpeed: 0x07},
+		0x21:       {FanSpeed: 0x07},
+		0x22:       {FanSpeed: 0x03},
+	})
+
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	if err := v.SetSpeedVerified(ctx, 3, 0x21); err != nil {
+		t.Errorf("expected no error but got %v", err)
+	}
+	if err := v.SetSpeedVerified(ctx, 3, 0x21, 0x22); err == nil {
+		t.Errorf("expected error when remote 0x22 reports different speed")
+	}
+	if err := v.SetSpeedVerified(ctx, 3, 0x23); err == nil {
+		t.Errorf("expected error when remote 0x23 does not respond")
+	}
+	if err := v.SetSpeedVerified(ctx, 9); !errors.Is(err, ErrInvalidValue) {
+		t.Errorf("expected error for invalid speed")
+	}
+}
+
+func TestSetSpeedVerifiedMulticastOption(t *testing.T) {
+	for _, multicast := range []bool{true, false} {
+		v := newTestVallox()
+		v.writeAllowed = true
+		v.remoteClientId = 0x27
+		v.speedMulticast = multicast
+		go drainEvents(v)
+		written := make(chan []byte, 1)
+		go func() {
+			var destinations []byte
+			for o := range v.out {
+				pkg := o.pkg
+				if pkg.Register == FanSpeed {
+					destinations = append(destinations, pkg.Destination)
+				} else if pkg.Register == 0 {
+					handlePackage(&Package{System: 1, Source: pkg.Destination, Destination: pkg.Source, Register: FanSpeed, Value: 0x07}, v)
+					if pkg.Destination == DeviceMain {
+						written <- destinations
+						return
+					}
+				}
+			}
+		}()
+
+		ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+		if err := v.SetSpeedVerified(ctx, 3); err != nil {
+			t.Errorf("expected no error but got %v", err)
+		}
+		cancel()
+		expected := []byte{DeviceMain}
+		if multicast {
+			expected = append(expected, RemoteClientMulticast)
+		}
+		if destinations := <-written; !bytes.Equal(destinations, expected) {
+			t.Errorf("multicast %v: expected speed written to %x but got %x", multicast, expected, destinations)
+		}
+	}
+}
+
+// fakeSpeedDevice answers fan speed queries with its current speed and
+// applies writes, calling write first to decide if the write is applied.
+// The device stops when the test ends.
+func fakeSpeedDevice(t *testing.T, v *Vallox, speed byte, write func(n int) bool) {
+	stop := make(chan struct{})
+	stopped := make(chan struct{})
+	t.Cleanup(func() {
+		close(stop)
+		<-stopped
+	})
+	go func() {
+		defer close(stopped)
+		writes := 0
+		for {
+			var pkg Package
+			select {
+			case o := <-v.out:
+				pkg = o.pkg
+			case <-stop:
+				return
+			}
+			switch {
+			case pkg.Register == 0 && pkg.Value == FanSpeed:
+				handlePackage(&Package{System: 1, Source: DeviceMain, Destination: pkg.Source, Register: FanSpeed, Value: speed}, v)
+			case pkg.Register == FanSpeed && pkg.Destination == DeviceMain:
+				writes++
+				if write(writes) {
+					speed = pkg.Value
+				}
+			}
+		}
+	}()
+}
+
+func TestSetSpeedConfirmed(t *testing.T) {
+	tests := []struct {
+		name  string
+		write func(v *Vallox, n int) bool
+		valid bool
+	}{
+		{"first write", func(v *Vallox, n int) bool { return true }, true},
+		{"first write lost", func(v *Vallox, n int) bool { return n > 1 }, true},
+		{"all writes lost", func(v *Vallox, n int) bool { return false }, false},
+		{"changed at panel", func(v *Vallox, n int) bool {
+			handlePackage(&Package{System: 1, Source: 0x21, Destination: DeviceMain, Register: FanSpeed, Value: 0x0f}, v)
+			return false
+		}, true},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			v := newTestVallox()
+			v.remoteClientId = 0x27
+			v.writeAllowed = true
+			go drainEvents(v)
+			fakeSpeedDevice(t, v, 0x01, func(n int) bool { return test.write(v, n) })
+
+			ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+			defer cancel()
+			if err := v.SetSpeedConfirmed(ctx, 3); (err == nil) != test.valid {
+				t.Errorf("unexpected result %v", err)
+			}
+		})
+	}
+	if err := newTestVallox().SetSpeedConfirmed(context.Background(), 9); !errors.Is(err, ErrInvalidValue) {
+		t.Errorf("expected error for invalid speed")
+	}
+}
+
+// echoingPort echoes written frames back like RS485 adapters do and
+// answers fan speed queries of the main device with a speed that writes
+// do not change
+type echoingPort struct {
+	r *io.PipeReader
+	w *io.PipeWriter
+}
+
+func newEchoingPort() *echoingPort {
+	r, w := io.Pipe()
+	return &echoingPort{r, w}
+}
+
+func (p *echoingPort) Read(b []byte) (int, error) { return p.r.Read(b) }
+
+func (p *echoingPort) Write(b []byte) (int, error) {
+	data := append([]byte(nil), b...)
+	if b[2] == DeviceMain && b[3] == 0 && b[4] == FanSpeed {
+		data = append(data, testFrame(DeviceMain, b[1], FanSpeed, 0x01)...)
+	}
+	go p.w.Write(data)
+	return len(b), nil
+}
+
+func (p *echoingPort) Close() error {
+	p.w.Close()
+	return p.r.Close()
+}
+
+func TestSetSpeedConfirmedIgnoresEcho(t *testing.T) {
+	v, err := OpenPort(Config{EnableWrite: true, WriteMinGap: time.Millisecond}, newEchoingPort())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer v.Close()
+	go drainEvents(v)
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	if err := v.SetSpeedConfirmed(ctx, 3); err == nil {
+		t.Errorf("expected error when main device keeps reporting the old speed")
+	}
+}
+
+func TestProtectionSettings(t *testing.T) {
+	v := newTestVallox()
+	v.remoteClientId = 0x27
+	go respond(v, map[byte]byte{HumidityLimit: 0x99, BypassTemp: 160})
+
+	ctx, cancel := context.WithTimeout(context.Background(), 200*time.Millisecond)
+	defer cancel()
+	if rh, err := v.HumidityLimit(ctx); err != nil || rh != 50 {
+		t.Errorf("expected humidity limit 50 but got %d, %v", rh, err)
+	}
+	if temp, err := v.BypassTemp(ctx); err != nil || temp != 20 {
+		t.Errorf("expected bypass temperature 20 but got %d, %v", temp, err)
+	}
+}
+
+func TestQueryRaw(t *testing.T) {
+	v := newTestVallox()
+	v.remoteClientId = 0x27
+	go drainEvents(v)
+	// 0x10 is below valid humidity range and would not be decoded
+	go respond(v, map[byte]byte{Rh1: 0x10, FanSpeed: 0x07})
+
+	ctx, cancel := context.WithTimeout(context.Background(), 200*time.Millisecond)
+	defer cancel()
+	if raw, err := v.QueryRaw(ctx, Rh1); err != nil || raw != 0x10 {
+		t.Errorf("expected raw 0x10 but got %x, %v", raw, err)
+	}
+	if raw, err := v.QueryRaw(ctx, FanSpeed); err != nil || raw != 0x07 {
+		t.Errorf("expected raw 0x07 but got %x, %v", raw, err)
+	}
+}
+
+func TestGet(t *testing.T) {
+	v := newTestVallox()
+	v.remoteClientId = 0x27
+	go drainEvents(v)
+	go respond(v, map[byte]byte{FanSpeed: 0x1f})
+	ctx, cancel := context.WithTimeout(context.Background(), 200*time.Millisecond)
+	defer cancel()
+
+	var wg sync.WaitGroup
+	for i := 0; i < 3; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if e, err := v.Get(ctx, FanSpeed); err != nil || e.Value != 5 {
+				t.Errorf("expected speed 5 but got %d, %v", e.Value, err)
+			}
+		}()
+	}
+	wg.Wait()
+
+	// no response
+	if _, err := v.Get(ctx, Rh1); err != context.DeadlineExceeded {
+		t.Errorf("expected deadline exceeded but got %v", err)
+	}
+}
+
+func TestGetOrQuery(t *testing.T) {
+	v := newTestVallox()
+	v.remoteClientId = 0x27
+	go drainEvents(v)
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+
+	// fresh cached value is returned without querying
+	v.cache.put(Event{Time: time.Now(), Register: FanSpeed, Value: 5})
+	if e, err := v.GetOrQuery(ctx, FanSpeed, time.Minute); err != nil || e.Value != 5 {
+		t.Errorf("expected cached speed 5 but got %d, %v", e.Value, err)
+	}
+	if len(v.out) != 0 {
+		t.Errorf("expected no query for fresh value")
+	}
+
+	// stale value is queried
+	v.cache.put(Event{Time: time.Now().Add(-time.Hour), Register: Rh1, Value: 10})
+	go respond(v, map[byte]byte{Rh1: 0x99})
+	if e, err := v.GetOrQuery(ctx, Rh1, time.Minute); err != nil || e.Value != 50 {
+		t.Errorf("expected queried rh 50 but got %d, %v", e.Value, err)
+	}
+}
+
+func TestCurrentSpeed(t *testing.T) {
+	v := newTestVallox()
+	v.remoteClientId = 0x27
+	go drainEvents(v)
+	go respond(v, map[byte]byte{FanSpeed: 0x1f})
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+
+	if speed, err := v.CurrentSpeed(ctx); err != nil || speed != 5 {
+		t.Errorf("expected queried speed 5 but got %d, %v", speed, err)
+	}
+	v.cache.put(Event{Time: time.Now().Add(time.Second), Register: FanSpeed, Value: 2})
+	if speed, err := v.CurrentSpeed(ctx); err != nil || speed != 2 {
+		t.Errorf("expected cached speed 2 but got %d, %v", speed, err)
+	}
+}
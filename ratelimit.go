@@ -0,0 +1,56 @@
+package valloxrs485
+
+import (
+	"sync"
+	"time"
+)
+
+// rateLimiter is a token bucket limiting the number of outgoing frames
+type rateLimiter struct {
+	mutex  sync.Mutex
+	rate   float64 // tokens per second
+	burst  float64
+	tokens float64
+	last   time.Time
+}
+
+func newRateLimiter(rate float64, burst int) *rateLimiter {
+	if burst < 1 {
+		burst = 1
+	}
+	return &rateLimiter{rate: rate, burst: float64(burst), tokens: float64(burst)}
+}
+
+// reserve takes a token and returns how long the caller has to wait before
+// the token may be used
+func (rl *rateLimiter) reserve(now time.Time) time.Duration {
+	rl.mutex.Lock()
+	defer rl.mutex.Unlock()
+	if !rl.last.IsZero() {
+		rl.tokens += now.Sub(rl.last).Seconds() * rl.rate
+		if rl.tokens > rl.burst {
+			rl.tokens = rl.burst
+		}
+	}
+	rl.last = now
+	rl.tokens--
+	if rl.tokens >= 0 {
+		return 0
+	}
+	return time.Duration(-rl.tokens / rl.rate * float64(time.Second))
+}
+
+// wait blocks until a frame may be sent.  Returns false if done was closed
+// while waiting.
+func (rl *rateLimiter) wait(done <-chan struct{}) bool {
+	d := rl.reserve(time.Now())
+	if d <= 0 {
+		return true
+	}
+	select {
+	case <-time.After(d):
+		return true
+	case <-done:
+		return false
+	}
+}
@@ -0,0 +1,99 @@
+package valloxrs485
+
+import (
+	"testing"
+	"time"
+)
+
+func TestRateLimiterBurst(t *testing.T) {
+	rl := newRateLimiter(10, 3)
+	now := time.Now()
+	for i := 0; i < 3; i++ {
+		if d := rl.reserve(now); d != 0 {
+			t.Errorf("expected frame %d within burst without delay but got %v", i, d)
+		}
+	}
+	// Further frames in the same burst are spaced by 1/rate
+	for i := 1; i <= 5; i++ {
+		expected := time.Duration(i) * 100 * time.Millisecond
+		if d := rl.reserve(now); d != expected {
+			t.Errorf("expected delay %v but got %v", expected, d)
+		}
+	}
+}
+
+func TestRateLimiterRefill(t *testing.T) {
+	rl := newRateLimiter(10, 1)
+	now := time.Now()
+	rl.reserve(now)
+	if d := rl.reserve(now.Add(50 * time.Millisecond)); d != 50*time.Millisecond {
+		t.Errorf("expected delay 50ms but got %v", d)
+	}
+	// Tokens do not accumulate beyond burst
+	now = now.Add(10 * time.Second)
+	if d := rl.reserve(now); d != 0 {
+		t.Errorf("expected no delay but got %v", d)
+	}
+	if d := rl.reserve(now); d != 100*time.Millisecond {
+		t.Errorf("expected delay 100ms but got %v", d)
+	}
+}
+
+func TestRateLimiterWait(t *testing.T) {
+	rl := newRateLimiter(50, 1)
+	start := time.Now()
+	for i := 0; i < 6; i++ {
+		rl.wait(nil)
+	}
+	if elapsed := time.Since(start); elapsed < 100*time.Millisecond {
+		t.Errorf("expected 6 frames at 50/s to take at least 100ms but took %v", elapsed)
+	}
+}
+
+func TestRateLimitedOutgoing(t *testing.T) {
+	v := newTestVallox()
+	v.remoteClientId = 0x27
+	v.writeMinGap = time.Millisecond
+	v.rateLimiter = newRateLimiter(10, 2)
+	v.running.Store(true)
+	port := &fakePort{}
+	v.port = port
+	stopped := make(chan struct{})
+	go func() {
+		handleOutgoing(v)
+		close(stopped)
+	}()
+
+	start := time.Now()
+	var results []<-chan error
+	for _, register := range []byte{FanSpeed, Rh1, TempIncomingInside} {
+		results = append(results, v.SubmitWrite(DeviceMain, 0, register))
+	}
+	for i, result := range results {
+		if err := <-result; err != nil {
+			t.Fatal(err)
+		}
+		elapsed := time.Since(start)
+		if i < 2 && elapsed > 50*time.Millisecond {
+			t.Errorf("expected frame %d within burst without delay but took %v", i, elapsed)
+		}
+		if i == 2 && elapsed < 90*time.Millisecond {
+			t.Errorf("expected frame after burst to be delayed but sent in %v", elapsed)
+		}
+	}
+
+	// Close interrupts waiting for the rate limit
+	v.rateLimiter = newRateLimiter(0.1, 1)
+	<-v.SubmitWrite(DeviceMain, 0, FanSpeed)
+	v.SubmitWrite(DeviceMain, 0, Rh1)
+	time.Sleep(10 * time.Millisecond)
+	v.Close()
+	select {
+	case <-stopped:
+	case <-time.After(time.Second):
+		t.Fatal("outgoing handler still waiting for rate limit after Close")
+	}
+	if len(port.written) != 4*6 {
+		t.Errorf("expected 4 frames written but got %x", port.written)
+	}
+}
@@ -0,0 +1,63 @@
+package valloxrs485
+
+import (
+	"io"
+	"time"
+)
+
+const (
+	defaultReconnectInterval = time.Second
+	maxReconnectInterval     = time.Minute
+)
+
+func (vallox *Vallox) getPort() io.ReadWriteCloser {
+	vallox.portMutex.Lock()
+	defer vallox.portMutex.Unlock()
+	return vallox.port
+}
+
+// replacePort takes port in use, false if Close has been called and port
+// was not taken
+func (vallox *Vallox) replacePort(port io.ReadWriteCloser) bool {
+	vallox.portMutex.Lock()
+	defer vallox.portMutex.Unlock()
+	if vallox.closed() {
+		return false
+	}
+	vallox.port = port
+	return true
+}
+
+// reconnect closes the failed port and re-opens the device, doubling delay
+// between attempts.  Returns when the device has been re-opened or Close
+// is called.
+func (vallox *Vallox) reconnect(readErr error) {
+	vallox.reportError(wrapError(ErrRead, readErr))
+	vallox.setConnection(Disconnected)
+	vallox.logPartialFrame()
+	vallox.buf.Reset()
+	vallox.getPort().Close()
+
+	delay := vallox.reconnectDelay
+	for {
+		vallox.logger.Infof("reconnecting in %v", delay)
+		select {
+		case <-vallox.done:
+			return
+		case <-time.After(delay):
+		}
+		port, err := vallox.reopen()
+		if err != nil {
+			vallox.logger.Warnf("reconnect failed: %v", err)
+			delay = min(delay*2, maxReconnectInterval)
+			continue
+		}
+		if !vallox.replacePort(port) {
+			port.Close()
+			return
+		}
+		vallox.setConnection(Connecting)
+		sendInit(vallox)
+		return
+	}
+}
@@ -0,0 +1,74 @@
+package valloxrs485
+
+import (
+	"errors"
+	"io"
+	"testing"
+	"time"
+)
+
+func TestReconnect(t *testing.T) {
+	r, w := io.Pipe()
+	v := newTestVallox()
+	v.readBufferSize = defaultReadBufferSize
+	v.port = failingPort{}
+	v.reconnectDelay = time.Millisecond
+	attempts := 0
+	v.reopen = func() (io.ReadWriteCloser, error) {
+		if attempts++; attempts < 3 {
+			return nil, errors.New("no device")
+		}
+		return pipePort{r}, nil
+	}
+	done := make(chan bool)
+	go func() {
+		handleIncoming(v)
+		close(done)
+	}()
+
+	go w.Write(testFrame(DeviceMain, RemoteClientMulticast, FanSpeed, 0x07))
+	if e := <-v.Events(); e.Value != 3 {
+		t.Errorf("expected speed 3 after reconnect but got %d", e.Value)
+	}
+	if attempts != 3 {
+		t.Errorf("expected 3 attempts but got %d", attempts)
+	}
+	if err := <-v.Errors(); !errors.Is(err, ErrRead) {
+		t.Errorf("expected read error but got %v", err)
+	}
+	if o := <-v.out; o.pkg.Register != 0 || o.pkg.Value != FanSpeed {
+		t.Errorf("expected init query after reconnect but got %+v", o.pkg)
+	}
+
+	v.Close()
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatalf("reader did not stop")
+	}
+}
+
+func TestReconnectStopsOnClose(t *testing.T) {
+	v := newTestVallox()
+	v.port = failingPort{}
+	v.reconnectDelay = time.Hour
+	v.reopen = func() (io.ReadWriteCloser, error) {
+		t.Errorf("unexpected reopen")
+		return nil, nil
+	}
+	done := make(chan bool)
+	go func() {
+		handleIncoming(v)
+		close(done)
+	}()
+	time.Sleep(10 * time.Millisecond)
+	v.Close()
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatalf("reader did not stop")
+	}
+	if _, ok := <-v.Events(); ok {
+		t.Errorf("expected events channel to be closed")
+	}
+}
@@ -0,0 +1,86 @@
+package valloxrs485
+
+import (
+	"bufio"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// Replay decodes frames captured with Config.FrameLog as if they were
+// received from the device.  Received frames of the capture are emitted on
+// Events as fast as the consumer reads them, sent frames are skipped.
+// Writes are discarded.  Events channel is closed at the end of the capture.
+// Event times are the time of replay, not the time of capture.  A malformed
+// line stops replay with an error sent to Errors and closes Events.
+func Replay(r io.Reader, cfg Config) (*Vallox, error) {
+	if err := applyDefaults(&cfg); err != nil {
+		return nil, err
+	}
+	vallox := newVallox(cfg, &replayPort{source: r, scanner: bufio.NewScanner(r)})
+	vallox.replay = true
+	vallox.start()
+	return vallox, nil
+}
+
+// replayPort reads received frames from a frame log
+type replayPort struct {
+	source  io.Reader
+	scanner *bufio.Scanner
+	line    int
+	pending []byte
+}
+
+func (p *replayPort) Read(b []byte) (int, error) {
+	for len(p.pending) == 0 {
+		if !p.scanner.Scan() {
+			if err := p.scanner.Err(); err != nil {
+				return 0, err
+			}
+			return 0, io.EOF
+		}
+		p.line++
+		frame, err := parseFrameLogLine(p.scanner.Text())
+		if err != nil {
+			return 0, fmt.Errorf("frame log line %d: %w", p.line, err)
+		}
+		p.pending = frame
+	}
+	n := copy(b, p.pending)
+	p.pending = p.pending[n:]
+	return n, nil
+}
+
+func (p *replayPort) Write(b []byte) (int, error) { return len(b), nil }
+
+func (p *replayPort) Close() error {
+	if closer, ok := p.source.(io.Closer); ok {
+		return closer.Close()
+	}
+	return nil
+}
+
+// parseFrameLogLine returns the frame of a received frame line written by
+// logFrame, or nil for sent frames and empty lines
+func parseFrameLogLine(line string) ([]byte, error) {
+	if strings.TrimSpace(line) == "" {
+		return nil, nil
+	}
+	fields := strings.Split(line, ",")
+	if len(fields) != 3 {
+		return nil, fmt.Errorf("expected 3 fields but got %d", len(fields))
+	}
+	frame, err := hex.DecodeString(fields[2])
+	if err != nil || len(frame) != 6 {
+		return nil, fmt.Errorf("invalid frame %q", fields[2])
+	}
+	switch fields[1] {
+	case frameReceived:
+		return frame, nil
+	case frameTransmitted:
+		return nil, nil
+	default:
+		return nil, fmt.Errorf("invalid direction %q", fields[1])
+	}
+}
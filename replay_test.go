@@ -0,0 +1,90 @@
+package valloxrs485
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestReplay(t *testing.T) {
+	capture := fmt.Sprintf("2024-01-02T15:04:05.1+02:00,rx,%x\n"+
+		"2024-01-02T15:04:05.2+02:00,tx,%x\n"+
+		"\n"+
+		"2024-01-02T15:04:05.3+02:00,rx,%x\n",
+		testFrame(DeviceMain, RemoteClientMulticast, FanSpeed, 0x07),
+		testFrame(0x27, DeviceMain, FanSpeed, 0x0f),
+		testFrame(DeviceMain, RemoteClientMulticast, FanSpeed, 0x1f))
+
+	v, err := Replay(strings.NewReader(capture), Config{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var values []int16
+	timeout := time.After(time.Second)
+	for done := false; !done; {
+		select {
+		case e, ok := <-v.Events():
+			if !ok {
+				done = true
+			} else {
+				values = append(values, e.Value)
+			}
+		case <-timeout:
+			t.Fatalf("events channel not closed at end of replay")
+		}
+	}
+	if len(values) != 2 || values[0] != 3 || values[1] != 5 {
+		t.Errorf("expected speeds [3 5] but got %v", values)
+	}
+}
+
+func TestReplayInvalidLine(t *testing.T) {
+	v, err := Replay(strings.NewReader("2024-01-02T15:04:05.1+02:00,rx,0111\n"), Config{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer v.Close()
+	select {
+	case err := <-v.Errors():
+		if !errors.Is(err, ErrRead) || !strings.Contains(err.Error(), "line 1") {
+			t.Errorf("expected read error for line 1 but got %v", err)
+		}
+	case <-time.After(time.Second):
+		t.Fatalf("no error for invalid line")
+	}
+	// Events is closed so that ranging over it terminates
+	timeout := time.After(time.Second)
+	for {
+		select {
+		case _, ok := <-v.Events():
+			if !ok {
+				return
+			}
+		case <-timeout:
+			t.Fatalf("events not closed after invalid line")
+		}
+	}
+}
+
+func TestParseFrameLogLine(t *testing.T) {
+	tests := []struct {
+		line     string
+		expected string
+		valid    bool
+	}{
+		{"2024-01-02T15:04:05+02:00,rx,011120290760", "011120290760", true},
+		{"2024-01-02T15:04:05+02:00,tx,011120290760", "", true},
+		{"", "", true},
+		{"2024-01-02T15:04:05+02:00,rx", "", false},
+		{"2024-01-02T15:04:05+02:00,rx,0111202907", "", false},
+		{"2024-01-02T15:04:05+02:00,xx,011120290760", "", false},
+	}
+	for _, test := range tests {
+		frame, err := parseFrameLogLine(test.line)
+		if (err == nil) != test.valid || fmt.Sprintf("%x", frame) != test.expected {
+			t.Errorf("expected %q, valid %v for %q but got %x, %v", test.expected, test.valid, test.line, frame, err)
+		}
+	}
+}
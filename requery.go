@@ -0,0 +1,60 @@
+package valloxrs485
+
+import (
+	"sync"
+	"time"
+)
+
+// requeryInterval is the minimum time between re-queries of a register,
+// so that a register constantly failing to decode is re-queried only once
+const requeryInterval = time.Minute
+
+// requerier re-queries registers whose values failed to decode
+type requerier struct {
+	mutex   sync.Mutex
+	pending chan byte
+	last    map[byte]time.Time
+}
+
+func newRequerier() *requerier {
+	return &requerier{pending: make(chan byte, 10), last: make(map[byte]time.Time)}
+}
+
+// failed schedules re-query for register unless it was re-queried recently,
+// never blocks
+func (r *requerier) failed(register byte, now time.Time) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	if last, found := r.last[register]; found && now.Sub(last) < requeryInterval {
+		return
+	}
+	select {
+	case r.pending <- register:
+		r.last[register] = now
+	default:
+	}
+}
+
+func handleRequery(vallox *Vallox) {
+	for {
+		var register byte
+		select {
+		case register = <-vallox.requerier.pending:
+		case <-vallox.done:
+			return
+		}
+		vallox.logger.Debugf("re-querying register %x after decode failure", register)
+		if err := vallox.queryPair(register); err != nil {
+			vallox.logger.Warnf("re-query: %v", err)
+		}
+	}
+}
+
+// requeryFailed schedules re-query for undecodable package from the main device
+func (vallox *Vallox) requeryFailed(pkg *Package) {
+	// CO2 high byte alone never decodes, low byte completes the pair
+	if vallox.requerier == nil || pkg.Source != DeviceMain || pkg.Register == Co2HighestHighByte || pkg.Register == Co2TargetHighByte {
+		return
+	}
+	vallox.requerier.failed(pkg.Register, time.Now())
+}
@@ -0,0 +1,40 @@
+package valloxrs485
+
+import (
+	"testing"
+	"time"
+)
+
+func TestRequeryOnFailure(t *testing.T) {
+	v := newTestVallox()
+	v.requerier = newRequerier()
+	go handleRequery(v)
+
+	// below valid humidity range
+	handlePackage(&Package{Source: DeviceMain, Destination: RemoteClientMulticast, Register: Rh1, Value: 0x10}, v)
+	if pkg := (<-v.out).pkg; pkg.Register != 0 || pkg.Value != Rh1 {
+		t.Errorf("expected query for Rh1 but got %+v", pkg)
+	}
+
+	// re-queried only once
+	handlePackage(&Package{Source: DeviceMain, Destination: RemoteClientMulticast, Register: Rh1, Value: 0x10}, v)
+	// not from main device
+	handlePackage(&Package{Source: 0x21, Destination: DeviceMain, Register: Rh2, Value: 0x10}, v)
+	// high byte alone is not a failure
+	handlePackage(&Package{Source: DeviceMain, Destination: RemoteClientMulticast, Register: Co2HighestHighByte, Value: 0x02}, v)
+	time.Sleep(10 * time.Millisecond)
+	if len(v.out) != 0 {
+		t.Errorf("expected no more queries but got %+v", (<-v.out).pkg)
+	}
+}
+
+func TestRequeryInterval(t *testing.T) {
+	r := newRequerier()
+	now := time.Now()
+	r.failed(Rh1, now)
+	r.failed(Rh1, now.Add(time.Second))
+	r.failed(Rh1, now.Add(requeryInterval))
+	if len(r.pending) != 2 {
+		t.Errorf("expected 2 re-queries but got %d", len(r.pending))
+	}
+}
@@ -0,0 +1,48 @@
+package valloxrs485
+
+// SelectFlags contains the bits of SelectRegister
+type SelectFlags struct {
+	PowerOn          bool `json:"powerOn"`
+	Co2Adjust        bool `json:"co2Adjust"`
+	RhAdjust         bool `json:"rhAdjust"`
+	HeatingEnabled   bool `json:"heatingEnabled"`
+	FilterGuard      bool `json:"filterGuard"`
+	HeatingIndicator bool `json:"heatingIndicator"`
+	FaultIndicator   bool `json:"faultIndicator"`
+	ServiceReminder  bool `json:"serviceReminder"`
+}
+
+// DecodeSelectFlags converts raw value of SelectRegister to flags, bit 0 is PowerOn
+func DecodeSelectFlags(raw byte) SelectFlags {
+	return SelectFlags{
+		PowerOn:          raw&0x01 != 0,
+		Co2Adjust:        raw&0x02 != 0,
+		RhAdjust:         raw&0x04 != 0,
+		HeatingEnabled:   raw&0x08 != 0,
+		FilterGuard:      raw&0x10 != 0,
+		HeatingIndicator: raw&0x20 != 0,
+		FaultIndicator:   raw&0x40 != 0,
+		ServiceReminder:  raw&0x80 != 0,
+	}
+}
+
+// Raw converts flags back to raw value of SelectRegister
+func (f SelectFlags) Raw() byte {
+	var raw byte
+	for i, set := range []bool{f.PowerOn, f.Co2Adjust, f.RhAdjust, f.HeatingEnabled,
+		f.FilterGuard, f.HeatingIndicator, f.FaultIndicator, f.ServiceReminder} {
+		if set {
+			raw |= 1 << i
+		}
+	}
+	return raw
+}
+
+// SelectFlags returns decoded flags of the event, false if the event is not
+// SelectRegister
+func (e Event) SelectFlags() (SelectFlags, bool) {
+	if e.Register != SelectRegister {
+		return SelectFlags{}, false
+	}
+	return DecodeSelectFlags(e.RawValue), true
+}
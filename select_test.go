@@ -0,0 +1,23 @@
+package valloxrs485
+
+import "testing"
+
+func TestSelectFlags(t *testing.T) {
+	f := DecodeSelectFlags(0x29)
+	expected := SelectFlags{PowerOn: true, HeatingEnabled: true, HeatingIndicator: true}
+	if f != expected {
+		t.Errorf("expected %+v but got %+v", expected, f)
+	}
+	for raw := 0; raw < 256; raw++ {
+		if back := DecodeSelectFlags(byte(raw)).Raw(); back != byte(raw) {
+			t.Errorf("expected raw %x but got %x", raw, back)
+		}
+	}
+
+	if f, ok := (Event{Register: SelectRegister, RawValue: 0x80}).SelectFlags(); !ok || !f.ServiceReminder {
+		t.Errorf("unexpected flags %+v", f)
+	}
+	if _, ok := (Event{Register: FanSpeed, RawValue: 0x80}).SelectFlags(); ok {
+		t.Errorf("expected fan speed not to have flags")
+	}
+}
@@ -0,0 +1,124 @@
+package valloxrs485
+
+import "time"
+
+// State contains the latest known values
+type State struct {
+	Time time.Time `json:"time"`
+	// Values contains the latest event of each register
+	Values map[byte]Event `json:"values"`
+
+	FanSpeed            Reading `json:"fanSpeed"`
+	TempIncomingOutside Reading `json:"tempIncomingOutside"`
+	TempOutgoingInside  Reading `json:"tempOutgoingInside"`
+	TempIncomingInside  Reading `json:"tempIncomingInside"`
+	TempOutgoingOutside Reading `json:"tempOutgoingOutside"`
+	RhHighest           Reading `json:"rhHighest"`
+	Co2                 Reading `json:"co2"`
+}
+
+// Reading is a decoded value and the time it was received.  Valid is
+// false if the value has not been received.
+type Reading struct {
+	Value int16     `json:"value"`
+	At    time.Time `json:"at"`
+	Valid bool      `json:"valid"`
+}
+
+// Snapshot returns the latest known values
+func (vallox *Vallox) Snapshot() State {
+	return vallox.cache.state(time.Now(), vallox.snapshotVariant())
+}
+
+func (c *valueCache) state(now time.Time, variant Variant) State {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	values := make(map[byte]Event, len(c.values))
+	for register, e := range c.values {
+		values[register] = e
+	}
+	return State{
+		Time:                now,
+		Values:              values,
+		FanSpeed:            reading(values, FanSpeed),
+		TempIncomingOutside: tempReading(values, variant, TempIncomingOutside, TempIncomingOutsideNew),
+		TempOutgoingInside:  tempReading(values, variant, TempOutgoingInside, TempOutgoingInsideNew),
+		TempIncomingInside:  tempReading(values, variant, TempIncomingInside, TempIncomingInsideNew),
+		TempOutgoingOutside: tempReading(values, variant, TempOutgoingOutside, TempOutgoingOutsideNew),
+		RhHighest:           reading(values, RhHighest),
+		Co2:                 reading(values, Co2HighestHighByte, Co2HighestLowByte),
+	}
+}
+
+// reading returns the latest value of given registers, temperatures may
+// be received in either old or new registers
+func reading(values map[byte]Event, registers ...byte) Reading {
+	var r Reading
+	for _, register := range registers {
+		if e, found := values[register]; found && !e.Time.Before(r.At) {
+			r = Reading{Value: e.Value, At: e.Time, Valid: true}
+		}
+	}
+	return r
+}
+
+// Snapshots returns channel receiving State built from the latest received
+// values at given interval.  A snapshot is skipped if the previous one has
+// not been consumed.  The channel is closed when reading from the bus stops,
+// or immediately if interval is not positive.
+func (vallox *Vallox) Snapshots(interval time.Duration) <-chan State {
+	states := make(chan State, 1)
+	if interval <= 0 {
+		vallox.logger.Debugf("no snapshots with interval %v", interval)
+		close(states)
+		return states
+	}
+	go func() {
+		defer close(states)
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for now := range ticker.C {
+			if !vallox.running.Load() {
+				return
+			}
+			select {
+			case states <- vallox.cache.state(now, vallox.snapshotVariant()):
+			default:
+			}
+		}
+	}()
+	return states
+}
+
+// Humidity returns the latest humidity of sensors 1 and 2 and the highest of
+// them in %RH.  Values not received are -1, ok is false if none of them has
+// been received.
+func (vallox *Vallox) Humidity() (rh1, rh2, highest int16, ok bool) {
+	s := vallox.Snapshot()
+	values := [3]int16{-1, -1, -1}
+	for i, register := range []byte{Rh1, Rh2, RhHighest} {
+		if r := reading(s.Values, register); r.Valid {
+			values[i], ok = r.Value, true
+		}
+	}
+	return values[0], values[1], values[2], ok
+}
+
+// SupplyFan returns the latest DC supply fan speed in percent, ok is false
+// if it has not been received
+func (vallox *Vallox) SupplyFan() (int16, bool) {
+	return vallox.latestValue(SupplyFanPercent)
+}
+
+// ExtractFan returns the latest DC extract fan speed in percent, ok is false
+// if it has not been received
+func (vallox *Vallox) ExtractFan() (int16, bool) {
+	return vallox.latestValue(ExtractFanPercent)
+}
+
+func (vallox *Vallox) latestValue(register byte) (int16, bool) {
+	if e, found := vallox.LastValue(register); found {
+		return e.Value, true
+	}
+	return -1, false
+}
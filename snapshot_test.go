@@ -0,0 +1,106 @@
+package valloxrs485
+
+import (
+	"testing"
+	"time"
+)
+
+func TestSnapshots(t *testing.T) {
+	v := newTestVallox()
+	v.running.Store(true)
+	go drainEvents(v)
+	handlePackage(&Package{Register: FanSpeed, Value: 0x07}, v)
+	handlePackage(&Package{Register: TempIncomingInside, Value: 0x80}, v)
+
+	states := v.Snapshots(10 * time.Millisecond)
+	s := <-states
+	if len(s.Values) != 2 || s.Values[FanSpeed].Value != 3 || s.Values[TempIncomingInside].RawValue != 0x80 {
+		t.Errorf("unexpected snapshot %+v", s)
+	}
+
+	handlePackage(&Package{Register: FanSpeed, Value: 0x0f}, v)
+	<-states // may have been taken before the change
+	if s := <-states; s.Values[FanSpeed].Value != 4 {
+		t.Errorf("expected speed 4 in snapshot but got %+v", s.Values[FanSpeed])
+	}
+
+	v.running.Store(false)
+	for range states {
+	}
+}
+
+func TestSnapshotsInvalidInterval(t *testing.T) {
+	v := newTestVallox()
+	v.running.Store(true)
+	for _, interval := range []time.Duration{0, -time.Second} {
+		if _, ok := <-v.Snapshots(interval); ok {
+			t.Errorf("expected closed channel for interval %v", interval)
+		}
+	}
+}
+
+func TestSnapshot(t *testing.T) {
+	v := newTestVallox()
+	now := time.Now()
+	v.cache.put(Event{Time: now.Add(-time.Minute), Register: FanSpeed, Value: 3})
+	v.cache.put(Event{Time: now.Add(-time.Hour), Register: TempIncomingInside, Value: 10})
+	v.cache.put(Event{Time: now, Register: TempIncomingInsideNew, Value: 12})
+	v.cache.put(Event{Time: now, Register: Co2HighestLowByte, Value: 650})
+
+	s := v.Snapshot()
+	if s.FanSpeed != (Reading{Value: 3, At: now.Add(-time.Minute), Valid: true}) {
+		t.Errorf("unexpected fan speed %+v", s.FanSpeed)
+	}
+	if s.TempIncomingInside.Value != 12 {
+		t.Errorf("expected newer temperature 12 but got %+v", s.TempIncomingInside)
+	}
+	if s.Co2.Value != 650 || !s.Co2.Valid {
+		t.Errorf("unexpected co2 %+v", s.Co2)
+	}
+	if s.RhHighest.Valid || s.TempOutgoingOutside.Valid {
+		t.Errorf("expected values not received to be invalid")
+	}
+}
+
+func TestSnapshotCo2HighByte(t *testing.T) {
+	v := newTestVallox()
+	now := time.Now()
+	v.cache.put(Event{Time: now.Add(-time.Minute), Register: Co2HighestLowByte, Value: 650})
+	// value completed by the high byte is newer
+	v.cache.put(Event{Time: now, Register: Co2HighestHighByte, Value: 900})
+
+	if s := v.Snapshot(); s.Co2 != (Reading{Value: 900, At: now, Valid: true}) {
+		t.Errorf("expected co2 completed by high byte but got %+v", s.Co2)
+	}
+}
+
+func TestHumidity(t *testing.T) {
+	v := newTestVallox()
+	if _, _, _, ok := v.Humidity(); ok {
+		t.Errorf("expected no humidity")
+	}
+	v.cache.put(Event{Time: time.Now(), Register: Rh1, Value: 40})
+	v.cache.put(Event{Time: time.Now(), Register: RhHighest, Value: 40})
+	if rh1, rh2, highest, ok := v.Humidity(); !ok || rh1 != 40 || rh2 != -1 || highest != 40 {
+		t.Errorf("unexpected humidity %d %d %d %v", rh1, rh2, highest, ok)
+	}
+	if !(Event{Register: Rh2}).IsHumidity() || (Event{Register: HumidityLimit}).IsHumidity() {
+		t.Errorf("unexpected humidity classification")
+	}
+}
+
+func TestDcFans(t *testing.T) {
+	v := newTestVallox()
+	go drainEvents(v)
+	if _, ok := v.SupplyFan(); ok {
+		t.Errorf("expected no supply fan speed")
+	}
+	handlePackage(&Package{Source: DeviceMain, Destination: RemoteClientMulticast, Register: SupplyFanPercent, Value: 65}, v)
+	handlePackage(&Package{Source: DeviceMain, Destination: RemoteClientMulticast, Register: ExtractFanPercent, Value: 101}, v)
+	if supply, ok := v.SupplyFan(); !ok || supply != 65 {
+		t.Errorf("expected supply fan 65 but got %d %v", supply, ok)
+	}
+	if extract, ok := v.ExtractFan(); ok {
+		t.Errorf("expected invalid extract fan speed to be discarded but got %d", extract)
+	}
+}
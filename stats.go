@@ -0,0 +1,145 @@
+package valloxrs485
+
+import (
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Stats contains counters about bus traffic
+type Stats struct {
+	// ValidFrames is the number of received frames with valid checksum
+	ValidFrames uint64
+	// ChecksumErrors is the number of positions in received data starting
+	// with the system byte but failing the checksum.  A high rate suggests
+	// bad wiring or noise on the bus.
+	ChecksumErrors uint64
+	// DiscardedBytes is the number of received bytes not belonging to any
+	// valid frame
+	DiscardedBytes uint64
+	// DiscardedFrames is the number of valid frames not delivered as events,
+	// see Discards
+	DiscardedFrames uint64
+	// DroppedOutgoing is the number of outgoing frames refused because
+	// writing the register is not allowed, or dropped because the outgoing
+	// queue was full
+	DroppedOutgoing uint64
+	// EchoedFrames is the number of received frames identical to a frame
+	// recently sent by us.  A high count suggests the adapter echoes our own
+	// transmissions back, e.g. due to wiring or adapter configuration.
+	EchoedFrames uint64
+	// DroppedEvents is the number of events dropped because Events channel
+	// was full, see Config.OnEventOverflow
+	DroppedEvents uint64
+	// ReadLatency contains durations of reads from the device, recorded if
+	// Config.MeasureLatency is set.  Reads block until data is available so
+	// durations include time waiting for bus traffic.
+	ReadLatency LatencyStats
+	// WriteLatency contains durations of writes to the device, recorded if
+	// Config.MeasureLatency is set
+	WriteLatency LatencyStats
+}
+
+// LatencyStats contains minimum, maximum and average duration of operations
+type LatencyStats struct {
+	Count uint64
+	Min   time.Duration
+	Max   time.Duration
+	Avg   time.Duration
+}
+
+type counters struct {
+	validFrames     atomic.Uint64
+	checksumErrors  atomic.Uint64
+	discardedBytes  atomic.Uint64
+	discardedFrames atomic.Uint64
+	droppedOutgoing atomic.Uint64
+	echoedFrames    atomic.Uint64
+	droppedEvents   atomic.Uint64
+	readLatency     latency
+	writeLatency    latency
+}
+
+// Stats returns snapshot of traffic counters
+func (vallox *Vallox) Stats() Stats {
+	return Stats{
+		ValidFrames:     vallox.counters.validFrames.Load(),
+		ChecksumErrors:  vallox.counters.checksumErrors.Load(),
+		DiscardedBytes:  vallox.counters.discardedBytes.Load(),
+		DiscardedFrames: vallox.counters.discardedFrames.Load(),
+		DroppedOutgoing: vallox.counters.droppedOutgoing.Load(),
+		EchoedFrames:    vallox.counters.echoedFrames.Load(),
+		DroppedEvents:   vallox.counters.droppedEvents.Load(),
+		ReadLatency:     vallox.counters.readLatency.stats(),
+		WriteLatency:    vallox.counters.writeLatency.stats(),
+	}
+}
+
+type latency struct {
+	mutex sync.Mutex
+	count uint64
+	min   time.Duration
+	max   time.Duration
+	total time.Duration
+}
+
+func (l *latency) record(d time.Duration) {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+	if l.count == 0 || d < l.min {
+		l.min = d
+	}
+	if d > l.max {
+		l.max = d
+	}
+	l.count++
+	l.total += d
+}
+
+func (l *latency) stats() LatencyStats {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+	if l.count == 0 {
+		return LatencyStats{}
+	}
+	return LatencyStats{Count: l.count, Min: l.min, Max: l.max, Avg: l.total / time.Duration(l.count)}
+}
+
+// echoWindow is how long after sending a received identical frame is considered an echo
+const echoWindow = 500 * time.Millisecond
+
+// maxSentFrames is the number of recently sent frames kept for echo detection
+const maxSentFrames = 8
+
+type sentFrame struct {
+	frame [6]byte
+	at    time.Time
+}
+
+// sentFrames keeps recently sent frames for echo detection
+type sentFrames struct {
+	mutex  sync.Mutex
+	frames []sentFrame
+}
+
+func (s *sentFrames) add(frame [6]byte, now time.Time) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	if len(s.frames) == maxSentFrames {
+		s.frames = s.frames[1:]
+	}
+	s.frames = append(s.frames, sentFrame{frame: frame, at: now})
+}
+
+// isEcho returns true and forgets the sent frame if frame was sent within echoWindow
+func (s *sentFrames) isEcho(frame [6]byte, now time.Time) bool {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	for i, f := range s.frames {
+		if f.frame == frame && now.Sub(f.at) <= echoWindow {
+			s.frames = append(s.frames[:i], s.frames[i+1:]...)
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,107 @@
+package valloxrs485
+
+import (
+	"testing"
+	"time"
+)
+
+func TestEchoedFrames(t *testing.T) {
+	v := newTestVallox()
+	v.remoteClientId = 0x27
+	go drainEvents(v)
+	sent := createWrite(v, DeviceMain, FanSpeed, 0x07)
+	v.sentFrames.add(sent.bytes(), time.Now())
+
+	v.buf.Write(testFrame(0x27, DeviceMain, FanSpeed, 0x07))
+	// same frame again is not an echo since the sent frame was already matched
+	v.buf.Write(testFrame(0x27, DeviceMain, FanSpeed, 0x07))
+	v.buf.Write(testFrame(DeviceMain, RemoteClientMulticast, FanSpeed, 0x07))
+	handleBuffer(v)
+
+	if echoed := v.Stats().EchoedFrames; echoed != 1 {
+		t.Errorf("expected 1 echoed frame but got %d", echoed)
+	}
+}
+
+func TestEchoWindow(t *testing.T) {
+	var s sentFrames
+	frame := [6]byte{1, 0x27, 0x11, 0x29, 0x07, 0x69}
+	now := time.Now()
+	s.add(frame, now)
+	if s.isEcho(frame, now.Add(echoWindow+time.Millisecond)) {
+		t.Errorf("expected frame outside echo window not to be an echo")
+	}
+	for i := 0; i < maxSentFrames+1; i++ {
+		s.add([6]byte{byte(i)}, now)
+	}
+	if len(s.frames) != maxSentFrames {
+		t.Errorf("expected at most %d sent frames but got %d", maxSentFrames, len(s.frames))
+	}
+}
+
+func TestLatency(t *testing.T) {
+	var l latency
+	if s := l.stats(); s != (LatencyStats{}) {
+		t.Errorf("expected empty stats but got %+v", s)
+	}
+	l.record(2 * time.Millisecond)
+	l.record(6 * time.Millisecond)
+	l.record(4 * time.Millisecond)
+	expected := LatencyStats{Count: 3, Min: 2 * time.Millisecond, Max: 6 * time.Millisecond, Avg: 4 * time.Millisecond}
+	if s := l.stats(); s != expected {
+		t.Errorf("expected %+v but got %+v", expected, s)
+	}
+}
+
+func TestReadLatencyRecorded(t *testing.T) {
+	v := newTestVallox()
+	v.readBufferSize = 6
+	v.measureLatency = true
+	v.port = &fakePort{data: testFrame(DeviceMain, RemoteClientMulticast, FanSpeed, 0x07)}
+	go drainEvents(v)
+	handleIncoming(v)
+	// one successful read and one failing with io.EOF
+	if s := v.Stats().ReadLatency; s.Count != 2 {
+		t.Errorf("expected 2 reads recorded but got %+v", s)
+	}
+}
+
+func TestProtocolStats(t *testing.T) {
+	v := newTestVallox()
+	go drainEvents(v)
+	bad := testFrame(DeviceMain, RemoteClientMulticast, FanSpeed, 0x07)
+	bad[5]++
+	v.buf.Write([]byte{0x55, 0x55})
+	v.buf.Write(bad)
+	v.buf.Write(testFrame(DeviceMain, RemoteClientMulticast, FanSpeed, 0x07))
+	// undecodable humidity is discarded
+	v.buf.Write(testFrame(DeviceMain, RemoteClientMulticast, Rh1, 0x10))
+	handleBuffer(v)
+
+	v.running.Store(true)
+	v.port = &fakePort{}
+	go handleOutgoing(v)
+	defer v.Close()
+	<-v.SubmitWrite(DeviceMain, FanSpeed, 0x07)
+
+	expected := Stats{ValidFrames: 2, ChecksumErrors: 1, DiscardedBytes: 8, DiscardedFrames: 1, DroppedOutgoing: 1}
+	if s := v.Stats(); s != expected {
+		t.Errorf("expected %+v but got %+v", expected, s)
+	}
+}
+
+func TestDroppedOutgoingStats(t *testing.T) {
+	v := newTestVallox()
+	v.SetSpeed(3)
+	v.writeAllowed = true
+	v.WriteRegister(DeviceMain, TempIncomingInside, 0x80)
+	v.out = make(chan outgoing, 1)
+	v.Query(FanSpeed)
+	v.Query(FanSpeed)
+	<-v.SubmitWrite(DeviceMain, FanSpeed, 0x07)
+
+	// refused writes and frames not fitting in the queue
+	if dropped := v.Stats().DroppedOutgoing; dropped != 4 {
+		t.Errorf("expected 4 dropped outgoing frames but got %d", dropped)
+	}
+}
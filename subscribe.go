@@ -0,0 +1,101 @@
+package valloxrs485
+
+import "sync"
+
+// subscriptionBuffer is the number of events buffered for a subscriber
+// before events are dropped for it
+const subscriptionBuffer = 50
+
+type subscription struct {
+	filter func(Event) bool
+	ch     chan Event
+}
+
+type subscriptions struct {
+	mutex sync.Mutex
+	list  []*subscription
+}
+
+// SubscribeDestination returns channel receiving events whose Destination
+// is dst.  Events are dropped if the channel is not consumed.  Use
+// Unsubscribe to stop receiving events.
+func (vallox *Vallox) SubscribeDestination(dst byte) <-chan Event {
+	return vallox.subscriptions.add(func(e Event) bool { return e.Destination == dst })
+}
+
+// Subscribe calls fn for each event of register.  Calls are made in order
+// from a goroutine of the subscription, so fn does not block reading the
+// bus, but events are dropped if fn falls behind.  The returned function
+// stops the subscription and can be called multiple times.  The
+// subscription also stops on Close.
+func (vallox *Vallox) Subscribe(register byte, fn func(Event)) (unsubscribe func()) {
+	return vallox.subscribe(func(e Event) bool { return e.Register == register }, fn)
+}
+
+// SubscribeAll calls fn for every event like Subscribe does for events of
+// a single register
+func (vallox *Vallox) SubscribeAll(fn func(Event)) (unsubscribe func()) {
+	return vallox.subscribe(func(Event) bool { return true }, fn)
+}
+
+func (vallox *Vallox) subscribe(filter func(Event) bool, fn func(Event)) func() {
+	ch := vallox.subscriptions.add(filter)
+	var once sync.Once
+	unsubscribe := func() {
+		once.Do(func() { vallox.subscriptions.remove(ch) })
+	}
+	go func() {
+		for {
+			select {
+			case e, ok := <-ch:
+				if !ok {
+					return
+				}
+				fn(e)
+			case <-vallox.done:
+				unsubscribe()
+				return
+			}
+		}
+	}()
+	return unsubscribe
+}
+
+// Unsubscribe stops delivering events to ch and closes it
+func (vallox *Vallox) Unsubscribe(ch <-chan Event) {
+	vallox.subscriptions.remove(ch)
+}
+
+func (s *subscriptions) add(filter func(Event) bool) chan Event {
+	sub := &subscription{filter: filter, ch: make(chan Event, subscriptionBuffer)}
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.list = append(s.list, sub)
+	return sub.ch
+}
+
+func (s *subscriptions) remove(ch <-chan Event) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	for i, sub := range s.list {
+		if sub.ch == ch {
+			s.list = append(s.list[:i], s.list[i+1:]...)
+			close(sub.ch)
+			return
+		}
+	}
+}
+
+func (s *subscriptions) publish(e Event) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	for _, sub := range s.list {
+		if !sub.filter(e) {
+			continue
+		}
+		select {
+		case sub.ch <- e:
+		default:
+		}
+	}
+}
@@ -0,0 +1,91 @@
+package valloxrs485
+
+import (
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestSubscribeDestination(t *testing.T) {
+	v := newTestVallox()
+	go drainEvents(v)
+	main := v.SubscribeDestination(DeviceMain)
+	broadcast := v.SubscribeDestination(RemoteClientMulticast)
+
+	handlePackage(&Package{Source: 0x21, Destination: DeviceMain, Register: FanSpeed, Value: 0x07}, v)
+	handlePackage(&Package{Source: DeviceMain, Destination: RemoteClientMulticast, Register: FanSpeed, Value: 0x0f}, v)
+	handlePackage(&Package{Source: DeviceMain, Destination: 0x21, Register: FanSpeed, Value: 0x1f}, v)
+
+	if e := <-main; e.Source != 0x21 || len(main) != 0 {
+		t.Errorf("expected only event to main device but got %+v and %d more", e, len(main))
+	}
+	if e := <-broadcast; e.Value != 4 || len(broadcast) != 0 {
+		t.Errorf("expected only broadcast event but got %+v and %d more", e, len(broadcast))
+	}
+
+	v.Unsubscribe(main)
+	handlePackage(&Package{Source: 0x21, Destination: DeviceMain, Register: FanSpeed, Value: 0x07}, v)
+	if _, ok := <-main; ok {
+		t.Errorf("expected channel to be closed after unsubscribe")
+	}
+}
+
+func TestSubscribe(t *testing.T) {
+	v := newTestVallox()
+	go drainEvents(v)
+	var mutex sync.Mutex
+	var speeds []int16
+	received := make(chan bool, 10)
+	unsubscribe := v.Subscribe(FanSpeed, func(e Event) {
+		mutex.Lock()
+		speeds = append(speeds, e.Value)
+		mutex.Unlock()
+		received <- true
+	})
+
+	handlePackage(&Package{Register: FanSpeed, Value: 0x07}, v)
+	handlePackage(&Package{Register: TempIncomingInside, Value: 0x80}, v)
+	handlePackage(&Package{Register: FanSpeed, Value: 0x0f}, v)
+	<-received
+	<-received
+
+	var wg sync.WaitGroup
+	for i := 0; i < 3; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			unsubscribe()
+		}()
+	}
+	wg.Wait()
+	handlePackage(&Package{Register: FanSpeed, Value: 0x1f}, v)
+	time.Sleep(10 * time.Millisecond)
+
+	mutex.Lock()
+	defer mutex.Unlock()
+	if len(speeds) != 2 || speeds[0] != 3 || speeds[1] != 4 {
+		t.Errorf("expected speeds [3 4] but got %v", speeds)
+	}
+}
+
+func TestSubscribeStopsOnClose(t *testing.T) {
+	v := newTestVallox()
+	v.port = &fakePort{}
+	v.Subscribe(FanSpeed, func(e Event) {})
+	v.SubscribeAll(func(e Event) {})
+	v.Close()
+
+	deadline := time.Now().Add(time.Second)
+	for {
+		v.subscriptions.mutex.Lock()
+		remaining := len(v.subscriptions.list)
+		v.subscriptions.mutex.Unlock()
+		if remaining == 0 {
+			return
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("expected subscriptions to stop on close, %d remaining", remaining)
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
@@ -0,0 +1,85 @@
+package valloxrs485
+
+import "sync"
+
+// Comparator defines direction of a threshold crossing
+type Comparator int
+
+const (
+	// Above fires when value rises above the threshold
+	Above Comparator = iota
+	// Below fires when value falls below the threshold
+	Below
+)
+
+type thresholdCallback struct {
+	cmp        Comparator
+	threshold  int16
+	hysteresis int16
+	fn         func(Event)
+	crossed    bool
+}
+
+type thresholdCallbacks struct {
+	mutex     sync.Mutex
+	callbacks map[byte][]*thresholdCallback
+}
+
+// OnThreshold registers fn to be called when decoded value of the register
+// crosses threshold in direction of cmp.  After firing, fn is not called again
+// until the value has returned past threshold by the default hysteresis of
+// the register, 50 ppm for CO2 and 1 for other registers.  fn is called from
+// the reader goroutine and must not block.
+func (vallox *Vallox) OnThreshold(register byte, cmp Comparator, threshold int16, fn func(Event)) {
+	vallox.OnThresholdHysteresis(register, cmp, threshold, defaultHysteresis(register), fn)
+}
+
+// OnThresholdHysteresis is like OnThreshold with explicit hysteresis
+func (vallox *Vallox) OnThresholdHysteresis(register byte, cmp Comparator, threshold, hysteresis int16, fn func(Event)) {
+	vallox.thresholds.mutex.Lock()
+	defer vallox.thresholds.mutex.Unlock()
+	if vallox.thresholds.callbacks == nil {
+		vallox.thresholds.callbacks = make(map[byte][]*thresholdCallback)
+	}
+	c := &thresholdCallback{cmp: cmp, threshold: threshold, hysteresis: hysteresis, fn: fn}
+	vallox.thresholds.callbacks[register] = append(vallox.thresholds.callbacks[register], c)
+}
+
+func defaultHysteresis(register byte) int16 {
+	if register == Co2HighestHighByte || register == Co2HighestLowByte {
+		return 50
+	}
+	return 1
+}
+
+func (tc *thresholdCallbacks) notify(e Event) {
+	var fired []func(Event)
+	tc.mutex.Lock()
+	for _, c := range tc.callbacks[e.Register] {
+		if !c.crossed && c.beyond(e.Value) {
+			c.crossed = true
+			fired = append(fired, c.fn)
+		} else if c.crossed && c.rearmed(e.Value) {
+			c.crossed = false
+		}
+	}
+	tc.mutex.Unlock()
+	// callbacks are called without the lock so they can register callbacks
+	for _, fn := range fired {
+		fn(e)
+	}
+}
+
+func (c *thresholdCallback) beyond(value int16) bool {
+	if c.cmp == Below {
+		return value < c.threshold
+	}
+	return value > c.threshold
+}
+
+func (c *thresholdCallback) rearmed(value int16) bool {
+	if c.cmp == Below {
+		return int(value) >= int(c.threshold)+int(c.hysteresis)
+	}
+	return int(value) <= int(c.threshold)-int(c.hysteresis)
+}
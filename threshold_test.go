@@ -0,0 +1,58 @@
+package valloxrs485
+
+import "testing"
+
+func TestOnThreshold(t *testing.T) {
+	v := newTestVallox()
+	go drainEvents(v)
+	var above, below []int16
+	v.OnThreshold(FanSpeed, Above, 4, func(e Event) {
+		above = append(above, e.Value)
+	})
+	v.OnThresholdHysteresis(FanSpeed, Below, 3, 2, func(e Event) {
+		below = append(below, e.Value)
+	})
+
+	// speeds 5 4 5 3 5 2 4 5 1
+	for _, value := range []byte{0x1f, 0x0f, 0x1f, 0x07, 0x1f, 0x03, 0x0f, 0x1f, 0x01} {
+		handlePackage(&Package{Register: FanSpeed, Value: value}, v)
+		handlePackage(&Package{Register: TempIncomingInside, Value: value}, v)
+	}
+
+	assertValues(t, []int16{5, 5, 5}, above)
+	assertValues(t, []int16{2, 1}, below)
+}
+
+func TestOnThresholdFromCallback(t *testing.T) {
+	v := newTestVallox()
+	go drainEvents(v)
+	var nested []int16
+	registered := false
+	v.OnThreshold(FanSpeed, Above, 4, func(e Event) {
+		if !registered {
+			registered = true
+			v.OnThreshold(FanSpeed, Above, 4, func(e Event) {
+				nested = append(nested, e.Value)
+			})
+		}
+	})
+
+	// speeds 5 4 5
+	for _, value := range []byte{0x1f, 0x0f, 0x1f} {
+		handlePackage(&Package{Register: FanSpeed, Value: value}, v)
+	}
+
+	assertValues(t, []int16{5}, nested)
+}
+
+func assertValues(t *testing.T, expected, values []int16) {
+	t.Helper()
+	if len(values) != len(expected) {
+		t.Fatalf("expected values %v but got %v", expected, values)
+	}
+	for i := range expected {
+		if values[i] != expected[i] {
+			t.Errorf("expected value %d at %d but got %d", expected[i], i, values[i])
+		}
+	}
+}
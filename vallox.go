@@ -3,12 +3,14 @@ package valloxrs485
 
 import (
 	"bytes"
-	"encoding/binary"
+	"context"
 	"fmt"
 	"io"
 	"log"
 	"math"
+	"path/filepath"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/tarm/serial"
@@ -18,49 +20,214 @@ import (
 type Config struct {
 	// Device file for rs485 device
 	Device string
+	// DeviceGlob is a pattern like /dev/ttyUSB* used to find the rs485 device
+	// when Device is not set or cannot be opened, first matching device is used
+	DeviceGlob string
+	// Baud rate for the rs485 device, default 9600 used by Vallox
+	Baud int
 	// RemoteClientId is the id for this device in Vallox rs485 bus
 	RemoteClientId byte
 	// Enable writing to Vallox regisers, default false
 	EnableWrite bool
-	// Logge for debug, default no logging
+	// DisableSpeedMulticast stops SetSpeed from publishing the new speed to
+	// remote clients, default false.  Remote panels then show the old speed
+	// until the main device broadcasts it, but bus traffic is reduced.
+	DisableSpeedMulticast bool
+	// Logger for debug, default no logging.  Messages of all levels are
+	// written to it if Logger is not set.
+	//
+	// Deprecated: use Logger, e.g. with a *log.Logger adapted to it.
 	LogDebug *log.Logger
+	// Logger receives messages at debug, info and warning levels, replaces
+	// LogDebug, default no logging
+	Logger Logger
+	// System byte used in frames, frames from other systems are discarded, default 1
+	System byte
+	// NormalizeTempRegisters reports temperatures from the old registers
+	// using the new register numbers, so each temperature has only one register
+	NormalizeTempRegisters bool
+	// PlausibleRanges contains ranges of plausible decoded values per register,
+	// frames outside the range are sent to Discards instead of Events
+	PlausibleRanges map[byte]Range
+	// DisconnectedTempValues contains raw values of temperature sensor registers
+	// that indicate a disconnected sensor, for example 0 and 255.  Such frames are
+	// routed to Discards instead of events.
+	DisconnectedTempValues []byte
+	// MaxFramesPerSecond limits outgoing frames, default 0 is unlimited
+	MaxFramesPerSecond float64
+	// MaxFramesBurst is the number of frames that can be sent at once within MaxFramesPerSecond, default 1
+	MaxFramesBurst int
+	// FaultDescriptions replaces DefaultFaultDescriptions used for Event.Text
+	// of FaultCode
+	FaultDescriptions map[byte]string
+	// Co2PairWindow is the time within which high and low CO2 bytes must both
+	// be received to be combined, default 500ms
+	Co2PairWindow time.Duration
+	// AutoCo2Interval is the minimum time between speed changes made by
+	// AutoCo2Control, default 5 minutes
+	AutoCo2Interval time.Duration
+	// ReadBufferSize is the maximum number of bytes read from device at once, default 128
+	ReadBufferSize int
+	// DesyncThreshold is the number of consecutive discarded bytes after which
+	// ErrFramingMismatch is sent to Errors, default 0 disables the check
+	DesyncThreshold int
+	// FrameLog receives a line for each valid frame received or sent, see
+	// logFrame for the format, default nil disables logging.  The log can be
+	// used as a capture of bus traffic for offline analysis.
+	FrameLog io.Writer
+	// RequeryOnFailure re-queries once a register whose value from the main
+	// device failed to decode, to reduce gaps in data
+	RequeryOnFailure bool
+	// StuckThreshold is the number of identical consecutive bytes without a
+	// valid frame after which ErrLineStuck is sent to Errors, default 0
+	// disables the check
+	StuckThreshold int
+	// AllowOff allows SetSpeed to turn the fan off with speed 0.  Ventilation
+	// stops completely, so this is disabled by default to prevent turning the
+	// unit off by accident.
+	AllowOff bool
+	// WriteMinGap is the time the bus must have been quiet before sending a
+	// frame, default 50ms.  Sending is retried when the gap has passed.
+	WriteMinGap time.Duration
+	// Reconnect re-opens the device with backoff after a read error instead
+	// of stopping.  Events channel is kept open during reconnection.
+	Reconnect bool
+	// ReconnectInterval is the delay before the first reconnection attempt,
+	// doubled after each failed attempt up to one minute, default 1 second
+	ReconnectInterval time.Duration
+	// WritableRegisters contains registers allowed to be written with
+	// WriteRegister in addition to the registers known by this library.
+	// EnableWrite must also be set.
+	WritableRegisters []byte
+	// MeasureLatency records durations of device reads and writes to Stats
+	MeasureLatency bool
+	// OnEventOverflow defines what happens when Events channel is full,
+	// default OverflowBlock
+	OnEventOverflow OverflowPolicy
+	// IdleTimeout sends ErrIdle to Errors when no valid frame has been
+	// received within the timeout, default 0 disables the check
+	IdleTimeout time.Duration
+	// TempTable replaces the built-in table converting raw temperature values
+	// to Celsius, e.g. to calibrate for a different thermistor.  The table
+	// must be non-decreasing.  Default nil uses the table for NTC 10k sensors.
+	TempTable *[256]int16
+	// EmitInvalid sends events of frames whose value failed to decode to
+	// Events with Valid false, in addition to Discards, default false
+	EmitInvalid bool
+	// HistorySize is the number of latest events kept for each register, default 0 keeps no history
+	HistorySize int
 }
 
+// Vallox is a connection to Vallox rs485 bus.  Its methods are safe for
+// concurrent use by multiple goroutines.
 type Vallox struct {
-	port           *serial.Port
+	port           io.ReadWriteCloser
+	portMutex      sync.Mutex
+	reopen         func() (io.ReadWriteCloser, error)
+	reconnectDelay time.Duration
+	readBufferSize int
 	remoteClientId byte
-	running        bool
+	system         byte
+	running        atomic.Bool
+	done           chan struct{}
+	closeOnce      sync.Once
+	closeInOnce    sync.Once
+	readerExited   atomic.Bool
+	replay         bool
 	//buffer         *bufio.ReadWriter
-	buf          *bytes.Buffer
-	in           chan Event
-	out          chan valloxPackage
-	lastActivity time.Time
-	writeAllowed bool
-	logDebug     *log.Logger
-	mutex        sync.Mutex
+	buf            *bytes.Buffer
+	in             chan Event
+	discards       chan Discard
+	errors         chan error
+	errorsMutex    sync.Mutex
+	errorsClosed   bool
+	states         chan ConnectionState
+	state          ConnectionState
+	out            chan outgoing
+	lastSent       time.Time
+	writeMinGap    time.Duration
+	lastReceived   time.Time
+	lastFrame      time.Time
+	idleTimeout    time.Duration
+	writeAllowed   bool
+	writable       map[byte]bool
+	speedMulticast bool
+	allowOff       bool
+	logger         Logger
+	mutex          sync.Mutex
+	seq            uint64
+	waiters        waiters
+	rawWaiters     waiters
+	history        *history
+	normalize      bool
+	tempTable      *[256]int16
+	emitInvalid    bool
 
-	co2 twoByteValue
+	plausibleRanges   map[byte]Range
+	disconnected      map[byte]bool
+	faultDescriptions map[byte]string
+	rateLimiter       *rateLimiter
+
+	co2ControlInterval time.Duration
+
+	desyncThreshold int
+	discardedBytes  int
+	stuckThreshold  int
+	stuckByte       byte
+	stuckBytes      int
+	checksumWarned  time.Time
+	checksumPending int
+
+	changes       changeCallbacks
+	thresholds    thresholdCallbacks
+	cache         valueCache
+	variant       variantDetector
+	subscriptions subscriptions
+
+	transformMutex sync.Mutex
+	transform      func(Event) Event
+
+	onEventOverflow OverflowPolicy
+
+	counters       counters
+	measureLatency bool
+	requerier      *requerier
+	sentFrames     sentFrames
+	clientIdWatch  clientIdWatch
+
+	frameLogMutex sync.Mutex
+	frameLog      io.Writer
+
+	framesMutex sync.Mutex
+	lastFrames  map[byte]sourceFrame
+
+	co2       twoByteValue
+	co2Target twoByteValue
 }
 
+// defaultCo2PairWindow is the default time within which both CO2 bytes must be received
+const defaultCo2PairWindow = 500 * time.Millisecond
+
 type twoByteValue struct {
-	high byteValue
-	low  byteValue
+	high   byteValue
+	low    byteValue
+	window time.Duration
 }
 
 func (tbv *twoByteValue) validValue(now time.Time) (int16, bool) {
-	limit := now.Add(-500 * time.Millisecond)
+	window := tbv.window
+	if window <= 0 {
+		window = defaultCo2PairWindow
+	}
+	limit := now.Add(-window)
 	if tbv.high.at.Before(limit) {
 		return -1, false
 	}
 	if tbv.low.at.Before(limit) {
 		return -1, false
 	}
-	// Both values are within 500ms of the current time
-	res := int16(tbv.high.value)<<8 + int16(tbv.low.value)
-	if res <= 0 {
-		return -1, false
-	}
-	return res, true
+	// Both values are within the window from the current time
+	return RawToCo2(tbv.high.value, tbv.low.value)
 }
 
 type byteValue struct {
@@ -68,16 +235,34 @@ type byteValue struct {
 	value byte
 }
 
+const defaultBaud = 9600
+
+const defaultReadBufferSize = 128
+
+// defaultWriteMinGap is the default time the bus must be quiet before sending
+const defaultWriteMinGap = 50 * time.Millisecond
+
+// Main units use addresses 0x11-0x1f and DeviceMulticast addresses all of
+// them.  In cascaded installations the second unit is DeviceSecondary.
 const (
 	DeviceMulticast       = 0x10
 	DeviceMain            = 0x11
+	DeviceSecondary       = 0x12
 	RemoteClientMulticast = 0x20
 )
 
+// IsMainDevice returns true if address belongs to a main unit
+func IsMainDevice(address byte) bool {
+	return address > DeviceMulticast && address < RemoteClientMulticast
+}
+
 // Some known registers
 const (
 	// Reading and writing fan speed
 	FanSpeed byte = 0x29
+	// Configured maximum and minimum fan speed
+	FanSpeedMax byte = 0xa5
+	FanSpeedMin byte = 0xa9
 
 	// Registers Vallox is broadcasting temperatures
 	TempIncomingOutside byte = 0x58
@@ -91,6 +276,41 @@ const (
 	TempIncomingInsideNew  byte = 0x35
 	TempOutgoingOutsideNew byte = 0x33
 
+	// Supply air temperature target used for post-heating
+	HeatingTarget byte = 0xa4
+
+	// Humidity level above which fan speed is increased, in %RH
+	HumidityLimit byte = 0xae
+	// Outdoor temperature above which heat recovery is bypassed
+	BypassTemp byte = 0xaf
+
+	// Service reminder (filter change) interval and remaining time in months
+	ServiceInterval  byte = 0xa6
+	ServiceRemaining byte = 0xab
+
+	// Code of the latest fault
+	FaultCode byte = 0x36
+
+	// Select register, bit field of power, adjustment and indicator flags,
+	// see SelectFlags
+	SelectRegister byte = 0xa3
+
+	// Flags 6 register, bit 5 activates fireplace/boost function and bit 6
+	// tells it is active, see SetBoost
+	Flags6 byte = 0x71
+
+	// Flags 5 register, bit 7 tells if preheating is on, decoded value is 1 when on
+	Preheating byte = 0x6f
+
+	// DC fan supply and extract speeds in percent, used by units with DC
+	// fans instead of the 1-8 FanSpeed
+	SupplyFanPercent  byte = 0xb0
+	ExtractFanPercent byte = 0xb1
+
+	// CO2 setpoint in ppm, the event of the low byte carries the combined value
+	Co2TargetHighByte byte = 0xb3
+	Co2TargetLowByte  byte = 0xb4
+
 	RhHighest          byte = 0x2a
 	Co2HighestHighByte byte = 0x2b
 	Co2HighestLowByte  byte = 0x2c
@@ -98,16 +318,46 @@ const (
 	Rh2                byte = 0x30
 )
 
+// normalizedTempRegisters maps old temperature registers to the new ones
+var normalizedTempRegisters = map[byte]byte{
+	TempIncomingOutside: TempIncomingOutsideNew,
+	TempOutgoingInside:  TempOutgoingInsideNew,
+	TempIncomingInside:  TempIncomingInsideNew,
+	TempOutgoingOutside: TempOutgoingOutsideNew,
+}
+
 type Event struct {
+	// Seq is a monotonically increasing sequence number assigned to each
+	// event when it is read from the bus.  It starts from 1 when the device
+	// is opened and is never reset during the lifetime of a Vallox instance,
+	// so gaps indicate lost events.
+	Seq         uint64    `json:"seq"`
 	Time        time.Time `json:"time"`
 	Source      byte      `json:"source"`
 	Destination byte      `json:"destination"`
 	Register    byte      `json:"register"`
 	RawValue    byte      `json:"raw"`
 	Value       int16     `json:"value"`
+	// Text describes the value, set for FaultCode
+	Text string `json:"text,omitempty"`
+	// Valid is false if the raw value failed to decode, Value is then the
+	// raw value.  Such events are emitted only if Config.EmitInvalid is set.
+	Valid bool `json:"valid"`
+}
+
+type sourceFrame struct {
+	frame [6]byte
+	at    time.Time
 }
 
-type valloxPackage struct {
+// outgoing is a package waiting to be sent, result receives the outcome if set
+type outgoing struct {
+	pkg    Package
+	result chan error
+}
+
+// Package is a frame on the bus
+type Package struct {
 	System      byte
 	Source      byte
 	Destination byte
@@ -116,13 +366,178 @@ type valloxPackage struct {
 	Checksum    byte
 }
 
-var writeAllowed = map[byte]bool{FanSpeed: true}
+// Range of heating target allowed by the control panel
+const (
+	minHeatingTarget = 10
+	maxHeatingTarget = 27
+)
+
+// Range of CO2 setpoint allowed by the control panel
+const (
+	minCo2Target = 500
+	maxCo2Target = 2000
+)
+
+// Ranges of protection settings allowed for writing
+const (
+	minHumidityLimit = 1
+	maxHumidityLimit = 99
+	minBypassTemp    = 0
+	maxBypassTemp    = 25
+)
+
+// writeAllowed contains registers known to be safe to write, more can be
+// allowed by Config.WritableRegisters
+var writeAllowed = map[byte]bool{
+	FanSpeed:          true,
+	HeatingTarget:     true,
+	HumidityLimit:     true,
+	BypassTemp:        true,
+	Co2TargetHighByte: true,
+	Co2TargetLowByte:  true,
+	Flags6:            true,
+}
+
+// co2HighBytes maps low byte registers of two byte CO2 values to their high
+// byte registers.  High byte alone never decodes, low byte completes the value.
+var co2HighBytes = map[byte]byte{
+	Co2HighestLowByte: Co2HighestHighByte,
+	Co2TargetLowByte:  Co2TargetHighByte,
+}
 
 // Open opens the rs485 device specified in Config
 func Open(cfg Config) (*Vallox, error) {
+	if err := prepareOpen(&cfg); err != nil {
+		return nil, err
+	}
+
+	port, device, err := openDevice(cfg.Device, cfg.DeviceGlob, cfg.Baud)
+	if err != nil {
+		return nil, err
+	}
+	cfg.Logger.Infof("opened device %s with baud %d", device, cfg.Baud)
+
+	vallox := newVallox(cfg, port)
+	if cfg.Reconnect {
+		vallox.reopen = reopenDevice(cfg)
+	}
+	vallox.start()
+	return vallox, nil
+}
+
+// OpenContext opens the device like Open and waits until the main device
+// responds to the initial fan speed query.  If ctx is cancelled or expires
+// before that, the device is closed and the context error is returned.
+// Cancelling ctx after OpenContext has returned closes the connection like
+// Close.
+func OpenContext(ctx context.Context, cfg Config) (*Vallox, error) {
+	if err := prepareOpen(&cfg); err != nil {
+		return nil, err
+	}
+
+	var reopen func() (io.ReadWriteCloser, error)
+	if cfg.Reconnect {
+		reopen = reopenDevice(cfg)
+	}
+	return openContext(ctx, cfg, func() (io.ReadWriteCloser, string, error) {
+		return openDevice(cfg.Device, cfg.DeviceGlob, cfg.Baud)
+	}, reopen)
+}
+
+type openResult struct {
+	port   io.ReadWriteCloser
+	device string
+	err    error
+}
+
+// openContext opens port with open, which may block, and starts the
+// connection once the main device responds or fails when ctx is done.
+// reopen is used for reconnecting after read errors if not nil.
+func openContext(ctx context.Context, cfg Config, open func() (io.ReadWriteCloser, string, error), reopen func() (io.ReadWriteCloser, error)) (*Vallox, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	opened := make(chan openResult, 1)
+	go func() {
+		port, device, err := open()
+		opened <- openResult{port, device, err}
+	}()
+
+	var result openResult
+	select {
+	case result = <-opened:
+		if result.err != nil {
+			return nil, result.err
+		}
+	case <-ctx.Done():
+		// close the port if opening still succeeds
+		go func() {
+			if result := <-opened; result.err == nil {
+				result.port.Close()
+			}
+		}()
+		return nil, ctx.Err()
+	}
+	cfg.Logger.Infof("opened device %s with baud %d", result.device, cfg.Baud)
+
+	vallox := newVallox(cfg, result.port)
+	vallox.reopen = reopen
+	ch := vallox.addWaiter(FanSpeed)
+	defer vallox.removeWaiter(FanSpeed, ch)
+	vallox.start()
+
+	select {
+	case <-ch:
+	case <-ctx.Done():
+		vallox.Close()
+		return nil, fmt.Errorf("waiting for response from main device: %w", ctx.Err())
+	}
+
+	go func() {
+		select {
+		case <-ctx.Done():
+			vallox.logger.Infof("context done: %v", ctx.Err())
+			vallox.Close()
+		case <-vallox.done:
+		}
+	}()
+	return vallox, nil
+}
+
+// reopenDevice returns function re-opening the device for reconnection
+func reopenDevice(cfg Config) func() (io.ReadWriteCloser, error) {
+	return func() (io.ReadWriteCloser, error) {
+		port, device, err := openDevice(cfg.Device, cfg.DeviceGlob, cfg.Baud)
+		if err == nil {
+			cfg.Logger.Infof("re-opened device %s", device)
+		}
+		return port, err
+	}
+}
+
+// prepareOpen applies defaults to cfg of a device to be opened and warns
+// about settings unlikely to work with Vallox
+func prepareOpen(cfg *Config) error {
+	if err := applyDefaults(cfg); err != nil {
+		return err
+	}
+	if cfg.Baud != defaultBaud {
+		cfg.Logger.Warnf("requested baud %d differs from Vallox default %d", cfg.Baud, defaultBaud)
+	}
+	return nil
+}
+
+// applyDefaults fills in default values of cfg and validates it
+func applyDefaults(cfg *Config) error {
+	if cfg.Logger == nil && cfg.LogDebug != nil {
+		cfg.Logger = stdLogger{cfg.LogDebug}
+	} else if cfg.Logger == nil {
+		cfg.Logger = nopLogger{}
+	}
 
-	if cfg.LogDebug == nil {
-		cfg.LogDebug = log.New(io.Discard, "", 0)
+	if cfg.System == 0 {
+		cfg.System = 1
 	}
 
 	if cfg.RemoteClientId == 0 {
@@ -130,33 +545,189 @@ func Open(cfg Config) (*Vallox, error) {
 	}
 
 	if cfg.RemoteClientId < 0x20 || cfg.RemoteClientId > 0x2f {
-		return nil, fmt.Errorf("invalid remoteClientId %x", cfg.RemoteClientId)
+		return fmt.Errorf("invalid remoteClientId %x", cfg.RemoteClientId)
 	}
 
-	portCfg := &serial.Config{Name: cfg.Device, Baud: 9600, Size: 8, Parity: 'N', StopBits: 1}
-	port, err := serial.OpenPort(portCfg)
-	if err != nil {
+	if cfg.Baud == 0 {
+		cfg.Baud = defaultBaud
+	}
+
+	if cfg.TempTable != nil {
+		for i := 1; i < len(cfg.TempTable); i++ {
+			if cfg.TempTable[i] < cfg.TempTable[i-1] {
+				return fmt.Errorf("temperature table decreases at raw value %d", i)
+			}
+		}
+	}
+	return nil
+}
+
+// OpenPort uses already opened port, e.g. a fake bus in tests, instead of
+// opening the device specified in Config.  Device, DeviceGlob and Baud of
+// Config are ignored.  The port is closed by Close.
+func OpenPort(cfg Config, port io.ReadWriteCloser) (*Vallox, error) {
+	if err := applyDefaults(&cfg); err != nil {
 		return nil, err
 	}
 
+	vallox := newVallox(cfg, port)
+	vallox.start()
+	return vallox, nil
+}
+
+// newVallox creates connection using port, cfg must have defaults applied
+func newVallox(cfg Config, port io.ReadWriteCloser) *Vallox {
 	buffer := new(bytes.Buffer)
 	vallox := &Vallox{
-		port:           port,
-		running:        true,
-		buf:            buffer,
-		remoteClientId: cfg.RemoteClientId,
-		in:             make(chan Event, 50),
-		out:            make(chan valloxPackage, 50),
-		writeAllowed:   cfg.EnableWrite,
-		logDebug:       cfg.LogDebug,
+		port:              port,
+		buf:               buffer,
+		remoteClientId:    cfg.RemoteClientId,
+		system:            cfg.System,
+		normalize:         cfg.NormalizeTempRegisters,
+		tempTable:         cfg.TempTable,
+		emitInvalid:       cfg.EmitInvalid,
+		plausibleRanges:   cfg.PlausibleRanges,
+		disconnected:      make(map[byte]bool),
+		faultDescriptions: cfg.FaultDescriptions,
+		in:                make(chan Event, 50),
+		onEventOverflow:   cfg.OnEventOverflow,
+		discards:          make(chan Discard, 50),
+		errors:            make(chan error, 10),
+		desyncThreshold:   cfg.DesyncThreshold,
+		stuckThreshold:    cfg.StuckThreshold,
+		states:            make(chan ConnectionState, 10),
+		out:               make(chan outgoing, 50),
+		done:              make(chan struct{}),
+		writeAllowed:      cfg.EnableWrite,
+		speedMulticast:    !cfg.DisableSpeedMulticast,
+		frameLog:          cfg.FrameLog,
+		measureLatency:    cfg.MeasureLatency,
+		idleTimeout:       cfg.IdleTimeout,
+		writeMinGap:       cfg.WriteMinGap,
+		logger:            cfg.Logger,
+	}
+
+	if cfg.MaxFramesPerSecond > 0 {
+		vallox.rateLimiter = newRateLimiter(cfg.MaxFramesPerSecond, cfg.MaxFramesBurst)
+	}
+
+	vallox.writable = make(map[byte]bool)
+	for _, register := range cfg.WritableRegisters {
+		vallox.writable[register] = true
+	}
+	for _, raw := range cfg.DisconnectedTempValues {
+		vallox.disconnected[raw] = true
+	}
+	vallox.co2.window = cfg.Co2PairWindow
+	vallox.co2Target.window = cfg.Co2PairWindow
+	vallox.co2ControlInterval = cfg.AutoCo2Interval
+	if vallox.co2ControlInterval == 0 {
+		vallox.co2ControlInterval = defaultCo2ControlInterval
+	}
+
+	vallox.reconnectDelay = cfg.ReconnectInterval
+	if vallox.reconnectDelay <= 0 {
+		vallox.reconnectDelay = defaultReconnectInterval
+	}
+
+	vallox.readBufferSize = cfg.ReadBufferSize
+	if vallox.readBufferSize < 1 {
+		vallox.readBufferSize = defaultReadBufferSize
+	}
+
+	vallox.running.Store(true)
+	vallox.states <- Connecting
+
+	if cfg.HistorySize > 0 {
+		vallox.history = newHistory(cfg.HistorySize)
+	}
+
+	if cfg.RequeryOnFailure {
+		vallox.requerier = newRequerier()
 	}
+	return vallox
+}
 
+// start sends the initial query and starts reading and writing
+func (vallox *Vallox) start() {
 	sendInit(vallox)
 
+	if vallox.requerier != nil {
+		go handleRequery(vallox)
+	}
+
+	if vallox.idleTimeout > 0 {
+		go handleIdle(vallox, time.Now())
+	}
+
 	go handleIncoming(vallox)
 	go handleOutgoing(vallox)
+}
 
-	return vallox, nil
+// Close stops reading and writing and closes the device.  Events channel is
+// closed once the reader has stopped, so consumers ranging over it terminate.
+// Reading stops when the pending read returns, at the latest when the next
+// byte is received from the bus.  Other methods must not be used after Close.
+func (vallox *Vallox) Close() error {
+	var err error
+	vallox.closeOnce.Do(func() {
+		vallox.logger.Infof("closing")
+		vallox.running.Store(false)
+		close(vallox.done)
+		err = vallox.getPort().Close()
+		vallox.setConnection(Disconnected)
+		vallox.closeErrors()
+		if vallox.readerExited.Load() {
+			vallox.closeEvents()
+		}
+	})
+	return err
+}
+
+// closed returns true if Close has been called
+func (vallox *Vallox) closed() bool {
+	select {
+	case <-vallox.done:
+		return true
+	default:
+		return false
+	}
+}
+
+// closeEvents closes events channel, called by the reader or Close,
+// whichever notices the other has finished
+func (vallox *Vallox) closeEvents() {
+	vallox.closeInOnce.Do(func() {
+		close(vallox.in)
+	})
+}
+
+// openDevice opens device, or if that is not possible the first device matching glob
+func openDevice(device string, glob string, baud int) (*serial.Port, string, error) {
+	candidates := []string{}
+	if device != "" {
+		candidates = append(candidates, device)
+	}
+	if glob != "" {
+		matches, err := filepath.Glob(glob)
+		if err != nil {
+			return nil, "", err
+		}
+		candidates = append(candidates, matches...)
+	}
+	if len(candidates) == 0 {
+		return nil, "", fmt.Errorf("no device found for %q or %q", device, glob)
+	}
+
+	var err error
+	for _, name := range candidates {
+		var port *serial.Port
+		portCfg := &serial.Config{Name: name, Baud: baud, Size: 8, Parity: 'N', StopBits: 1}
+		if port, err = serial.OpenPort(portCfg); err == nil {
+			return port, name, nil
+		}
+	}
+	return nil, "", fmt.Errorf("unable to open device with baud %d: %w", baud, err)
 }
 
 // Events returns channel for events from Vallox bus
@@ -169,92 +740,309 @@ func (vallox *Vallox) ForMe(e Event) bool {
 	return e.Destination == RemoteClientMulticast || e.Destination == vallox.remoteClientId
 }
 
-// Query queries Vallox for register
-func (vallox *Vallox) Query(register byte) {
-	pkg := createQuery(vallox, register)
-	vallox.out <- *pkg
+// Query queries Vallox for register.  ErrQueueFull is returned if the query
+// cannot be queued.
+func (vallox *Vallox) Query(register byte) error {
+	return vallox.enqueue(outgoing{pkg: *createQuery(vallox, DeviceMain, register)})
 }
 
-// SetSpeed changes speed of ventilation fan
-func (vallox *Vallox) SetSpeed(speed byte) {
-	if speed < 1 || speed > 8 {
-		vallox.logDebug.Printf("received invalid speed %x", speed)
-		return
-	}
-	value := speedToValue(int8(speed))
-	vallox.logDebug.Printf("received set speed %x", speed)
+// QueryDevice queries register from given main unit, e.g. DeviceSecondary
+// in cascaded installations.  Writes to it can be made with SubmitWrite.
+func (vallox *Vallox) QueryDevice(device, register byte) error {
+	return vallox.enqueue(outgoing{pkg: *createQuery(vallox, device, register)})
+}
+
+// QueryMulticast queries register from all remote clients.  Each remote
+// answering sends its own response, which can be told apart by Event.Source.
+// Only DeviceMain is known to answer queries on tested units, remote
+// panels may not respond at all.
+func (vallox *Vallox) QueryMulticast(register byte) error {
+	return vallox.enqueue(outgoing{pkg: *createQuery(vallox, RemoteClientMulticast, register)})
+}
+
+// SetSpeed changes speed of ventilation fan.  Speed 0 turns the fan off and
+// is accepted only if Config.AllowOff is set.  If the speed was queued to the
+// main device but the multicast to remotes failed, the returned error wraps
+// ErrRemotesNotUpdated and the main device is still updated.
+func (vallox *Vallox) SetSpeed(speed byte) error {
 	// Send value to the main vallox device
-	vallox.writeRegister(DeviceMain, FanSpeed, value)
-	// Also publish value to all the remotes
-	vallox.writeRegister(RemoteClientMulticast, FanSpeed, value)
+	if err := vallox.SetSpeedTo(DeviceMain, speed); err != nil {
+		return err
+	}
+	if vallox.speedMulticast {
+		// Also publish value to all the remotes
+		if err := vallox.SetSpeedTo(RemoteClientMulticast, speed); err != nil {
+			return wrapError(ErrRemotesNotUpdated, err)
+		}
+	}
+	return nil
+}
+
+// SetSpeedTo writes fan speed to destination, which can be a main device,
+// a remote client or a multicast address in range 0x10-0x2f.  Speed 0 is
+// accepted only if Config.AllowOff is set.
+func (vallox *Vallox) SetSpeedTo(destination, speed byte) error {
+	if destination < DeviceMulticast || destination > 0x2f {
+		return fmt.Errorf("%w: destination %x", ErrInvalidValue, destination)
+	}
+	if (speed == 0 && !vallox.allowOff) || speed > 8 {
+		return fmt.Errorf("%w: speed %d", ErrInvalidValue, speed)
+	}
+	vallox.logger.Infof("received set speed %x to %x", speed, destination)
+	return vallox.writeRegister(destination, FanSpeed, speedToValue(int8(speed)))
+}
+
+// SetSpeedPercentClamped sets fan speed as percentage of the range between
+// fan speed min and max configured in the unit, so 0% is the configured
+// minimum and 100% the configured maximum.  The limits must have been
+// received, e.g. by FanSettings.
+func (vallox *Vallox) SetSpeedPercentClamped(pct byte) error {
+	if pct > 100 {
+		return fmt.Errorf("%w: percentage %d", ErrInvalidValue, pct)
+	}
+	minSpeed, minFound := vallox.LastValue(FanSpeedMin)
+	maxSpeed, maxFound := vallox.LastValue(FanSpeedMax)
+	if !minFound || !maxFound {
+		return fmt.Errorf("%w: fan speed limits", ErrNotReceived)
+	}
+	return vallox.SetSpeed(percentToSpeed(pct, minSpeed.Value, maxSpeed.Value))
+}
+
+// percentToSpeed maps percentage to speed between minSpeed and maxSpeed
+func percentToSpeed(pct byte, minSpeed, maxSpeed int16) byte {
+	if maxSpeed < minSpeed {
+		maxSpeed = minSpeed
+	}
+	steps := float64(maxSpeed-minSpeed) * float64(pct) / 100
+	return byte(minSpeed + int16(math.Round(steps)))
+}
+
+// SetHeatingTarget changes the supply air temperature target in Celsius
+func (vallox *Vallox) SetHeatingTarget(celsius int16) error {
+	if celsius < minHeatingTarget || celsius > maxHeatingTarget {
+		return fmt.Errorf("%w: heating target %d, allowed %d-%d", ErrInvalidValue, celsius, minHeatingTarget, maxHeatingTarget)
+	}
+	value, ok := tempToValueWith(vallox.temps(), celsius)
+	if !ok {
+		return fmt.Errorf("%w: heating target %d not in temperature table", ErrInvalidValue, celsius)
+	}
+	vallox.logger.Infof("received set heating target %d", celsius)
+	return vallox.writeRegister(DeviceMain, HeatingTarget, value)
+}
+
+// SetHumidityLimit changes humidity level in %RH above which fan speed is increased
+func (vallox *Vallox) SetHumidityLimit(rh int16) error {
+	if rh < minHumidityLimit || rh > maxHumidityLimit {
+		return fmt.Errorf("%w: humidity limit %d, allowed %d-%d", ErrInvalidValue, rh, minHumidityLimit, maxHumidityLimit)
+	}
+	value, _ := RHToRaw(rh)
+	vallox.logger.Infof("received set humidity limit %d", rh)
+	return vallox.writeRegister(DeviceMain, HumidityLimit, value)
+}
+
+// SetBypassTemp changes outdoor temperature in Celsius above which heat recovery is bypassed
+func (vallox *Vallox) SetBypassTemp(celsius int16) error {
+	if celsius < minBypassTemp || celsius > maxBypassTemp {
+		return fmt.Errorf("%w: bypass temperature %d, allowed %d-%d", ErrInvalidValue, celsius, minBypassTemp, maxBypassTemp)
+	}
+	value, ok := tempToValueWith(vallox.temps(), celsius)
+	if !ok {
+		return fmt.Errorf("%w: bypass temperature %d not in temperature table", ErrInvalidValue, celsius)
+	}
+	vallox.logger.Infof("received set bypass temperature %d", celsius)
+	return vallox.writeRegister(DeviceMain, BypassTemp, value)
+}
+
+// SetCo2Target changes CO2 setpoint in ppm.  High byte is written first and
+// low byte only after the high byte has been sent, so the frames reach the
+// main device in order.  Returns once both frames have been sent.
+func (vallox *Vallox) SetCo2Target(ppm int16) error {
+	if ppm < minCo2Target || ppm > maxCo2Target {
+		return fmt.Errorf("%w: co2 target %d, allowed %d-%d", ErrInvalidValue, ppm, minCo2Target, maxCo2Target)
+	}
+	high, low := Co2ToRaw(ppm)
+	vallox.logger.Infof("received set co2 target %d", ppm)
+	if err := <-vallox.SubmitWrite(DeviceMain, Co2TargetHighByte, high); err != nil {
+		return err
+	}
+	return <-vallox.SubmitWrite(DeviceMain, Co2TargetLowByte, low)
 }
 
 func sendInit(vallox *Vallox) {
-	vallox.Query(FanSpeed)
+	if err := vallox.Query(FanSpeed); err != nil {
+		vallox.logger.Warnf("initial query: %v", err)
+	}
 }
 
-func (vallox *Vallox) writeRegister(destination byte, register byte, value byte) {
+// SubmitWrite queues writing value to register of destination device.  The
+// returned channel receives nil once the frame has been sent, or an error if
+// writing is not allowed, the outgoing queue is full or sending failed.
+func (vallox *Vallox) SubmitWrite(destination, register, value byte) <-chan error {
+	result := make(chan error, 1)
 	pkg := createWrite(vallox, destination, register, value)
-	vallox.out <- *pkg
+	if err := vallox.enqueue(outgoing{pkg: *pkg, result: result}); err != nil {
+		result <- err
+	}
+	return result
 }
 
-func createQuery(vallox *Vallox, register byte) *valloxPackage {
-	return createWrite(vallox, DeviceMain, 0, register)
+// WriteRegister queues writing value to register of destination device.
+// ErrWriteDisabled is returned if writing is not enabled, ErrNotWritable if
+// the register is not allowed to be written, see Config.WritableRegisters,
+// and ErrQueueFull if the write cannot be queued.
+func (vallox *Vallox) WriteRegister(destination, register, value byte) error {
+	if register == 0 {
+		return fmt.Errorf("%w: register 0 is reserved for queries", ErrInvalidValue)
+	}
+	return vallox.writeRegister(destination, register, value)
+}
+
+// writeRegister queues write if writing the register is allowed
+func (vallox *Vallox) writeRegister(destination byte, register byte, value byte) error {
+	if err := vallox.checkWrite(register); err != nil {
+		vallox.counters.droppedOutgoing.Add(1)
+		return err
+	}
+	return vallox.enqueue(outgoing{pkg: *createWrite(vallox, destination, register, value)})
+}
+
+// checkWrite returns error telling why writing register is not allowed
+func (vallox *Vallox) checkWrite(register byte) error {
+	if isOutgoingAllowed(vallox, register) {
+		return nil
+	}
+	if !vallox.writeAllowed {
+		return ErrWriteDisabled
+	}
+	return fmt.Errorf("%w: %x", ErrNotWritable, register)
 }
 
-func createWrite(vallox *Vallox, destination byte, register byte, value byte) *valloxPackage {
-	pkg := new(valloxPackage)
-	pkg.System = 1
+// enqueue queues outgoing package for sending without blocking
+func (vallox *Vallox) enqueue(o outgoing) error {
+	select {
+	case vallox.out <- o:
+		return nil
+	default:
+		vallox.logger.Warnf("outgoing queue full, dropped %x = %x to %x", o.pkg.Register, o.pkg.Value, o.pkg.Destination)
+		vallox.counters.droppedOutgoing.Add(1)
+		return ErrQueueFull
+	}
+}
+
+func createQuery(vallox *Vallox, destination byte, register byte) *Package {
+	return createWrite(vallox, destination, 0, register)
+}
+
+func createWrite(vallox *Vallox, destination byte, register byte, value byte) *Package {
+	pkg := new(Package)
+	pkg.System = vallox.system
 	pkg.Source = vallox.remoteClientId
 	pkg.Destination = destination
 	pkg.Register = register
 	pkg.Value = value
-	pkg.Checksum = calculateChecksum(pkg)
+	pkg.Checksum = CalculateChecksum(*pkg)
 	return pkg
 }
 
+// ifBusFreeProceed returns true and records sending if nothing has been
+// received or sent within the write gap
 func (vallox *Vallox) ifBusFreeProceed() bool {
-	//vallox.logDebug.Printf("if free proceed")
 	vallox.mutex.Lock()
 	defer vallox.mutex.Unlock()
-	if time.Since(vallox.lastActivity) < 100*time.Millisecond {
-		//vallox.logDebug.Printf("not free, no proceed")
+	gap := vallox.minGap()
+	if time.Since(vallox.lastReceived) < gap || time.Since(vallox.lastSent) < gap {
 		return false
 	}
-	vallox.lastActivity = time.Now()
-	//vallox.logDebug.Printf("free proceed")
+	vallox.lastSent = time.Now()
 	return true
 }
 
+// minGap returns how long the bus must be quiet before sending
+func (vallox *Vallox) minGap() time.Duration {
+	if vallox.writeMinGap <= 0 {
+		return defaultWriteMinGap
+	}
+	return vallox.writeMinGap
+}
+
+// getLastActivity returns when something was last received or sent
 func (vallox *Vallox) getLastActivity() time.Time {
-	//vallox.logDebug.Printf("get last activity")
 	vallox.mutex.Lock()
 	defer vallox.mutex.Unlock()
-	//vallox.logDebug.Printf("got last activity")
-	return vallox.lastActivity
+	if vallox.lastSent.After(vallox.lastReceived) {
+		return vallox.lastSent
+	}
+	return vallox.lastReceived
 }
 
 func handleOutgoing(vallox *Vallox) {
-	for vallox.running {
-		pkg := <-vallox.out
+	for vallox.running.Load() {
+		var o outgoing
+		select {
+		case o = <-vallox.out:
+		case <-vallox.done:
+			return
+		}
+		pkg := o.pkg
 
-		if !isOutgoingAllowed(vallox, pkg.Register) {
-			vallox.logDebug.Printf("outgoing not allowed for %x = %x", pkg.Register, pkg.Value)
+		if err := vallox.checkWrite(pkg.Register); err != nil {
+			vallox.logger.Debugf("outgoing not allowed for %x = %x", pkg.Register, pkg.Value)
+			vallox.counters.droppedOutgoing.Add(1)
+			o.done(err)
 			continue
 		}
 
-		if vallox.ifBusFreeProceed() {
-			binary.Write(vallox.port, binary.BigEndian, pkg)
-			vallox.logDebug.Printf("sent outgoing to %x %x = %x", pkg.Destination, pkg.Register, pkg.Value)
+		if vallox.rateLimiter != nil && !vallox.rateLimiter.wait(vallox.done) {
+			return
+		}
+
+		if !vallox.waitBusFree(pkg) {
+			return
+		}
+
+		start := time.Now()
+		_, err := vallox.getPort().Write(EncodeFrame(pkg))
+		if vallox.measureLatency {
+			vallox.counters.writeLatency.record(time.Since(start))
+		}
+		vallox.logger.Debugf("sent outgoing to %x %x = %x", pkg.Destination, pkg.Register, pkg.Value)
+		if err == nil {
+			vallox.sentFrames.add(pkg.bytes(), time.Now())
+			vallox.logFrame(frameTransmitted, &pkg)
 		} else {
-			la := vallox.getLastActivity()
-			now := time.Now()
-			vallox.logDebug.Printf("delay outgoing to %x %x = %x, lastActivity %v now %v, diff %d ms",
-				pkg.Destination, pkg.Register, pkg.Value, la, now, time.Since(la).Milliseconds())
-			time.Sleep(time.Millisecond * 57)
-			vallox.out <- pkg
+			err = wrapError(ErrWrite, err)
+			vallox.reportError(err)
+		}
+		o.done(err)
+	}
+}
+
+// waitBusFree waits until the bus has been quiet for the write gap.  The
+// package is kept while waiting so outgoing packages are sent in order.
+// Returns false if Close was called while waiting.
+func (vallox *Vallox) waitBusFree(pkg Package) bool {
+	for !vallox.ifBusFreeProceed() {
+		la := vallox.getLastActivity()
+		wait := vallox.minGap() - time.Since(la)
+		if wait < time.Millisecond {
+			wait = time.Millisecond
+		}
+		vallox.logger.Debugf("delay outgoing to %x %x = %x, lastActivity %v, diff %d ms, waiting %v",
+			pkg.Destination, pkg.Register, pkg.Value, la, time.Since(la).Milliseconds(), wait)
+		select {
+		case <-time.After(wait):
+		case <-vallox.done:
+			return false
 		}
 	}
+	return true
+}
+
+// done reports outcome of sending to the submitter, if anyone is waiting
+func (o outgoing) done(err error) {
+	if o.result != nil {
+		o.result <- err
+	}
 }
 
 func isOutgoingAllowed(vallox *Vallox, register byte) bool {
@@ -267,68 +1055,280 @@ func isOutgoingAllowed(vallox *Vallox, register byte) bool {
 		return false
 	}
 
-	return writeAllowed[register]
+	return writeAllowed[register] || vallox.writable[register]
 }
 
 func handleIncoming(vallox *Vallox) {
-	vallox.running = true
-	buf := make([]byte, 128)
-	for vallox.running {
-		n, err := vallox.port.Read(buf)
+	// registered first so that Events is closed even if Close was called
+	// before the reader started
+	defer vallox.readerStopped()
+	if vallox.closed() {
+		return
+	}
+	vallox.running.Store(true)
+	defer vallox.logPartialFrame()
+	buf := make([]byte, vallox.readBufferSize)
+	for vallox.running.Load() {
+		start := time.Now()
+		n, err := vallox.getPort().Read(buf)
+		if vallox.measureLatency {
+			vallox.counters.readLatency.record(time.Since(start))
+		}
+		if err != nil && vallox.reopen != nil && !vallox.closed() {
+			vallox.reconnect(err)
+			continue
+		}
+		if err != nil && vallox.replay {
+			// replay ends at the end of capture or at the first malformed
+			// line, close so that Events is closed for consumers
+			if err == io.EOF {
+				vallox.logger.Infof("end of replay")
+			} else {
+				fatalError(err, vallox)
+			}
+			vallox.Close()
+			return
+		}
 		if err != nil {
 			fatalError(err, vallox)
 			return
 		}
 		if n > 0 {
-			//vallox.logDebug.Printf("read %d bytes", n)
-			vallox.updateLastActivity()
+			//vallox.logger.Debugf("read %d bytes", n)
+			vallox.updateLastReceived()
 			vallox.buf.Write(buf[:n])
 			handleBuffer(vallox)
 		}
 	}
 }
 
-func (vallox *Vallox) updateLastActivity() {
-	//vallox.logDebug.Printf("updating last activity")
+func (vallox *Vallox) updateLastReceived() {
+	vallox.mutex.Lock()
+	defer vallox.mutex.Unlock()
+	vallox.lastReceived = time.Now()
+}
+
+// IdleSince returns how long the bus has been quiet, based on the last
+// received byte.  Our own transmissions are not taken into account.
+func (vallox *Vallox) IdleSince() time.Duration {
 	vallox.mutex.Lock()
 	defer vallox.mutex.Unlock()
-	vallox.lastActivity = time.Now()
-	//vallox.logDebug.Printf("updated last activity")
+	return time.Since(vallox.lastReceived)
+}
+
+// readerStopped closes events channel if the reader stopped because of Close
+func (vallox *Vallox) readerStopped() {
+	vallox.readerExited.Store(true)
+	if vallox.closed() {
+		vallox.closeEvents()
+	}
+}
+
+// logPartialFrame logs bytes of an incomplete frame left in the buffer when
+// reading stops.  The buffer is only accessed from the reader goroutine.
+func (vallox *Vallox) logPartialFrame() {
+	if vallox.buf.Len() > 0 {
+		vallox.logger.Debugf("reader stopped with partial frame %x", vallox.buf.Bytes())
+	}
 }
 
 func fatalError(err error, vallox *Vallox) {
-	vallox.logDebug.Printf("fatal error %v", err)
-	vallox.running = false
+	vallox.logger.Warnf("fatal error %v", err)
+	if !vallox.closed() {
+		vallox.reportError(wrapError(ErrRead, err))
+	}
+	vallox.running.Store(false)
+	vallox.setConnection(Disconnected)
+}
+
+// checksumWarnInterval is the minimum time between checksum error warnings
+const checksumWarnInterval = time.Minute
+
+// warnChecksumErrors logs checksum errors at most once per
+// checksumWarnInterval with the number of errors since the previous warning,
+// so that a noisy line does not flood the log
+func (vallox *Vallox) warnChecksumErrors(n int, now time.Time) {
+	vallox.checksumPending += n
+	if vallox.checksumPending == 0 || now.Sub(vallox.checksumWarned) < checksumWarnInterval {
+		return
+	}
+	vallox.logger.Warnf("%d checksum errors in received data", vallox.checksumPending)
+	vallox.checksumWarned, vallox.checksumPending = now, 0
 }
 
 func handleBuffer(vallox *Vallox) {
 	for vallox.buf.Len() >= 6 {
 		buf := vallox.buf.Bytes()
-		pkg := validPackage(buf)
-		if pkg != nil {
-			vallox.buf.Next(6)
-			handlePackage(pkg, vallox)
-		} else {
-			// discard byte, since no valid package starts here
-			vallox.buf.ReadByte()
-			//vallox.logDebug.Printf("invalid package, discarding byte %x, available %d", b, vallox.buf.Len())
+		offset, checksumErrors := nextFrame(buf, vallox.system)
+		vallox.counters.checksumErrors.Add(uint64(checksumErrors))
+		vallox.warnChecksumErrors(checksumErrors, time.Now())
+		skip := offset
+		if offset < 0 {
+			// no valid package starts in the buffer, keep the last 5 bytes
+			// since they may be start of a package not fully received yet
+			skip = len(buf) - 5
+		}
+		for _, b := range buf[:skip] {
+			vallox.checkDesync()
+			vallox.checkStuck(b)
+		}
+		vallox.counters.discardedBytes.Add(uint64(skip))
+		vallox.buf.Next(skip)
+		if offset < 0 {
+			return
+		}
+		pkg := validPackage(vallox.buf.Next(6), vallox.system)
+		vallox.counters.validFrames.Add(1)
+		vallox.updateLastFrame()
+		vallox.discardedBytes = 0
+		vallox.stuckBytes = 0
+		vallox.setConnection(Connected)
+		vallox.recordFrame(pkg)
+		vallox.logFrame(frameReceived, pkg)
+		if vallox.sentFrames.isEcho(pkg.bytes(), time.Now()) {
+			vallox.counters.echoedFrames.Add(1)
+		} else if pkg.Source == vallox.remoteClientId {
+			vallox.clientIdWatch.notify(*pkg)
+		}
+		handlePackage(pkg, vallox)
+	}
+}
+
+// nextFrame returns offset of the first valid package in buf or -1 if there is none,
+// and the number of positions starting with system byte but failing the checksum.
+// Sum of the five bytes preceding the checksum is maintained while sliding over
+// buf, so each candidate position is validated without re-reading the whole frame.
+func nextFrame(buf []byte, system byte) (offset int, checksumErrors int) {
+	if len(buf) < 6 {
+		return -1, 0
+	}
+	sum := buf[0] + buf[1] + buf[2] + buf[3] + buf[4]
+	for i := 0; ; i++ {
+		if buf[i] == system {
+			if buf[i+5] == sum {
+				return i, checksumErrors
+			}
+			checksumErrors++
+		}
+		if i+6 >= len(buf) {
+			return -1, checksumErrors
 		}
+		sum += buf[i+5] - buf[i]
+	}
+}
+
+// checkStuck reports an error every stuckThreshold identical consecutive discarded bytes
+func (vallox *Vallox) checkStuck(b byte) {
+	if vallox.stuckBytes > 0 && b == vallox.stuckByte {
+		vallox.stuckBytes++
+	} else {
+		vallox.stuckByte, vallox.stuckBytes = b, 1
+	}
+	if vallox.stuckThreshold > 0 && vallox.stuckBytes%vallox.stuckThreshold == 0 {
+		vallox.reportError(fmt.Errorf("%w: received byte %x %d times", ErrLineStuck, b, vallox.stuckBytes))
+	}
+}
+
+// checkDesync reports an error every desyncThreshold consecutive discarded bytes
+func (vallox *Vallox) checkDesync() {
+	vallox.discardedBytes++
+	if vallox.desyncThreshold > 0 && vallox.discardedBytes%vallox.desyncThreshold == 0 {
+		vallox.reportError(fmt.Errorf("%w: discarded %d consecutive bytes", ErrFramingMismatch, vallox.discardedBytes))
 	}
 }
 
-func handlePackage(pkg *valloxPackage, vallox *Vallox) {
+func (vallox *Vallox) recordFrame(pkg *Package) {
+	vallox.framesMutex.Lock()
+	defer vallox.framesMutex.Unlock()
+	if vallox.lastFrames == nil {
+		vallox.lastFrames = make(map[byte]sourceFrame)
+	}
+	vallox.lastFrames[pkg.Source] = sourceFrame{frame: pkg.bytes(), at: time.Now()}
+}
+
+// LastFrameFromSource returns the latest valid raw frame received from src and when it was received
+func (vallox *Vallox) LastFrameFromSource(src byte) ([6]byte, time.Time, bool) {
+	vallox.framesMutex.Lock()
+	defer vallox.framesMutex.Unlock()
+	f, found := vallox.lastFrames[src]
+	return f.frame, f.at, found
+}
+
+// SetEventTransform sets fn to modify each decoded event before it is
+// delivered.  Returning an Event with zero Time drops the event.  Set nil to
+// remove the transform.
+func (vallox *Vallox) SetEventTransform(fn func(Event) Event) {
+	vallox.transformMutex.Lock()
+	defer vallox.transformMutex.Unlock()
+	vallox.transform = fn
+}
+
+func (vallox *Vallox) transformEvent(e Event) Event {
+	vallox.transformMutex.Lock()
+	fn := vallox.transform
+	vallox.transformMutex.Unlock()
+	if fn == nil {
+		return e
+	}
+	return fn(e)
+}
+
+func handlePackage(pkg *Package, vallox *Vallox) {
+	vallox.notifyRawWaiters(pkg)
+	if vallox.sensorDisconnected(pkg) {
+		vallox.discard(pkg, reasonDisconnected)
+		return
+	}
 	e := event(pkg, vallox)
-	if e != nil {
-		vallox.in <- *e
+	if e == nil {
+		vallox.discard(pkg, undecodableReason(pkg))
+		vallox.requeryFailed(pkg)
+		if vallox.emitInvalid {
+			vallox.emitInvalidEvent(pkg)
+		}
+	} else if !vallox.plausible(e) {
+		vallox.discard(pkg, reasonImplausible)
+	} else if *e = vallox.transformEvent(*e); e.Time.IsZero() {
+		vallox.logger.Debugf("event transform dropped package from %x register %x", pkg.Source, pkg.Register)
 	} else {
-		vallox.logDebug.Printf("discarding package from %x register %x value %x", pkg.Source, pkg.Register, pkg.Value)
+		vallox.seq++
+		e.Seq = vallox.seq
+		if vallox.history != nil {
+			vallox.history.add(*e)
+		}
+		vallox.cache.put(*e)
+		if IsMainDevice(pkg.Source) {
+			vallox.variant.observe(pkg.Register)
+		}
+		vallox.notifyWaiters(*e)
+		vallox.changes.notify(*e)
+		vallox.thresholds.notify(*e)
+		vallox.subscriptions.publish(*e)
+		vallox.deliver(*e)
 	}
 }
 
+// emitInvalidEvent sends event with the raw value of undecodable package to
+// Events only, it is not cached nor passed to waiters or subscribers
+func (vallox *Vallox) emitInvalidEvent(pkg *Package) {
+	vallox.seq++
+	vallox.deliver(Event{
+		Seq:         vallox.seq,
+		Time:        time.Now(),
+		Source:      pkg.Source,
+		Destination: pkg.Destination,
+		Register:    pkg.Register,
+		RawValue:    pkg.Value,
+		Value:       int16(pkg.Value),
+	})
+}
+
 type mapFn func(byte, *Vallox) (int16, bool)
 
 var registerMap = map[byte]mapFn{
 	FanSpeed:               valueToSpeed,
+	FanSpeedMax:            valueToSpeed,
+	FanSpeedMin:            valueToSpeed,
 	TempIncomingInside:     valueToTemp,
 	TempIncomingOutside:    valueToTemp,
 	TempOutgoingInside:     valueToTemp,
@@ -337,21 +1337,50 @@ var registerMap = map[byte]mapFn{
 	TempIncomingOutsideNew: valueToTemp,
 	TempOutgoingInsideNew:  valueToTemp,
 	TempOutgoingOutsideNew: valueToTemp,
+	HeatingTarget:          valueToTemp,
+	Preheating:             valueToPreheating,
+	HumidityLimit:          valueToRh,
+	BypassTemp:             valueToTemp,
+	SupplyFanPercent:       valueToPercent,
+	ExtractFanPercent:      valueToPercent,
 
 	RhHighest:          valueToRh,
 	Rh1:                valueToRh,
 	Rh2:                valueToRh,
 	Co2HighestHighByte: valueToCo2High,
 	Co2HighestLowByte:  valueToCo2Low,
+	Co2TargetHighByte:  valueToCo2TargetHigh,
+	Co2TargetLowByte:   valueToCo2TargetLow,
+}
+
+// valueToPercent decodes linear percentage, values above 100 are invalid
+func valueToPercent(val byte, vallox *Vallox) (int16, bool) {
+	if val > 100 {
+		return -1, false
+	}
+	return int16(val), true
 }
 
+// minRhValue is the raw humidity value of 0 %RH, smaller values are below scale
+const minRhValue = 0x33
+
 func valueToRh(val byte, vallox *Vallox) (int16, bool) {
-	if val < 0x33 {
+	if val < minRhValue {
 		return -1, false
 	}
 	return int16(math.Round(float64((float32(val) - 51.0) / 2.04))), true
 }
 
+// preheatingBit is the bit in Flags 5 register telling if preheating is on
+const preheatingBit = 0x80
+
+func valueToPreheating(val byte, vallox *Vallox) (int16, bool) {
+	if val&preheatingBit != 0 {
+		return 1, true
+	}
+	return 0, true
+}
+
 func valueToCo2High(val byte, vallox *Vallox) (int16, bool) {
 	now := time.Now()
 	vallox.co2.high = byteValue{at: now, value: val}
@@ -364,7 +1393,19 @@ func valueToCo2Low(val byte, vallox *Vallox) (int16, bool) {
 	return vallox.co2.validValue(now)
 }
 
-func event(pkg *valloxPackage, vallox *Vallox) *Event {
+func valueToCo2TargetHigh(val byte, vallox *Vallox) (int16, bool) {
+	now := time.Now()
+	vallox.co2Target.high = byteValue{at: now, value: val}
+	return vallox.co2Target.validValue(now)
+}
+
+func valueToCo2TargetLow(val byte, vallox *Vallox) (int16, bool) {
+	now := time.Now()
+	vallox.co2Target.low = byteValue{at: now, value: val}
+	return vallox.co2Target.validValue(now)
+}
+
+func event(pkg *Package, vallox *Vallox) *Event {
 	event := new(Event)
 	event.Time = time.Now()
 	event.Source = pkg.Source
@@ -381,10 +1422,32 @@ func event(pkg *valloxPackage, vallox *Vallox) *Event {
 	} else {
 		event.Value = int16(pkg.Value)
 	}
+	event.Valid = true
+	if pkg.Register == FaultCode {
+		event.Text = vallox.faultText(pkg.Value)
+	}
+	event.Register = vallox.eventRegister(event.Register)
 	return event
 }
 
+// eventRegister returns the register events of register are reported with,
+// the new temperature register if Config.NormalizeTempRegisters is set
+func (vallox *Vallox) eventRegister(register byte) byte {
+	if vallox.normalize {
+		if r, found := normalizedTempRegisters[register]; found {
+			return r
+		}
+	}
+	return register
+}
+
+// speedOffValue is the raw fan speed value when the fan is off
+const speedOffValue = 0x00
+
 func valueToSpeed(value byte, vallox *Vallox) (int16, bool) {
+	if value == speedOffValue {
+		return 0, true
+	}
 	for i, v := range fanSpeedConversion {
 		if value == v {
 			return int16(i) + 1, true
@@ -394,33 +1457,114 @@ func valueToSpeed(value byte, vallox *Vallox) (int16, bool) {
 }
 
 func speedToValue(speed int8) byte {
+	if speed == 0 {
+		return speedOffValue
+	}
 	return fanSpeedConversion[speed-1]
 }
 
 func valueToTemp(value byte, vallox *Vallox) (int16, bool) {
-	return tempConversion[value], true
+	return vallox.temps()[value], true
+}
+
+// temps returns the temperature table of Config.TempTable or the built-in
+// one, vallox may be nil
+func (vallox *Vallox) temps() *[256]int16 {
+	if vallox == nil || vallox.tempTable == nil {
+		return &tempConversion
+	}
+	return vallox.tempTable
+}
+
+// tempToValue returns raw value for temperature using the built-in table
+func tempToValue(celsius int16) (byte, bool) {
+	return tempToValueWith(&tempConversion, celsius)
 }
 
-func validPackage(buf []byte) (pkg *valloxPackage) {
-	pkg = &valloxPackage{buf[0], buf[1], buf[2], buf[3], buf[4], buf[5]}
+// tempToValueWith returns raw value for temperature in table.  Several raw
+// values map to the same temperature so the middle one of them is used.
+func tempToValueWith(table *[256]int16, celsius int16) (byte, bool) {
+	first, last := -1, -1
+	for i, t := range table {
+		if t == celsius {
+			if first < 0 {
+				first = i
+			}
+			last = i
+		} else if t > celsius && first < 0 {
+			// No exact match, use the next higher temperature if within table range
+			if i == 0 {
+				return 0, false
+			}
+			return byte(i), true
+		}
+	}
+	if first < 0 {
+		return 0, false
+	}
+	return byte((first + last) / 2), true
+}
 
-	if validChecksum(pkg) && pkg.System == 1 {
-		return pkg
+func validPackage(buf []byte, system byte) (pkg *Package) {
+	decoded, ok := DecodeFrame(buf[:6])
+	if ok && decoded.System == system {
+		return &decoded
 	}
 
 	return nil
 }
 
-func validChecksum(pkg *valloxPackage) bool {
-	return pkg.Checksum == calculateChecksum(pkg)
+// bytes returns the frame in wire order: system, source, destination,
+// register, value and checksum.  Reading uses the same order in DecodeFrame
+// and validPackage.
+func (pkg *Package) bytes() [6]byte {
+	return [6]byte{pkg.System, pkg.Source, pkg.Destination, pkg.Register, pkg.Value, pkg.Checksum}
 }
 
-func calculateChecksum(pkg *valloxPackage) byte {
+// ToFrame rebuilds the wire frame of the event for given system.  Register
+// of the frame is the register of the event, which differs from the received
+// one if Config.NormalizeTempRegisters is set.
+func (e Event) ToFrame(system byte) [6]byte {
+	pkg := Package{System: system, Source: e.Source, Destination: e.Destination, Register: e.Register, Value: e.RawValue}
+	pkg.Checksum = CalculateChecksum(pkg)
+	return pkg.bytes()
+}
+
+// ValidChecksum returns true if checksum of pkg matches its contents
+func ValidChecksum(pkg Package) bool {
+	return pkg.Checksum == CalculateChecksum(pkg)
+}
+
+// CalculateChecksum returns checksum of pkg, the sum of the other bytes
+func CalculateChecksum(pkg Package) byte {
 	return pkg.System + pkg.Source + pkg.Destination + pkg.Register + pkg.Value
 }
 
+// DecodeFrame decodes 6 byte frame, false if frame is not 6 bytes or its
+// checksum is not valid
+func DecodeFrame(frame []byte) (Package, bool) {
+	if len(frame) != 6 {
+		return Package{}, false
+	}
+	pkg := Package{frame[0], frame[1], frame[2], frame[3], frame[4], frame[5]}
+	return pkg, ValidChecksum(pkg)
+}
+
+// EncodeFrame returns the 6 byte frame of pkg in wire order.  Checksum is
+// taken from pkg as is, it can be set with CalculateChecksum.
+func EncodeFrame(pkg Package) []byte {
+	b := pkg.bytes()
+	return b[:]
+}
+
 var fanSpeedConversion = [8]byte{0x01, 0x03, 0x07, 0x0f, 0x1f, 0x3f, 0x7f, 0xff}
 
+// tempConversion maps raw NTC sensor values to Celsius.  The table is
+// non-decreasing but not strictly increasing: most temperatures are
+// reported by two or three consecutive raw values, there are gaps near the
+// ends (e.g. 82 is followed by 86) and the tail saturates so that raw values
+// 247-255 are all 100.  Inverse conversion in tempToValue must therefore
+// pick one of several raw values and round temperatures falling into gaps.
 var tempConversion = [256]int16{
 	-74, -70, -66, -62, -59, -56, -54, -52, -50, -48, -47, -46, -44, -43, -42, -41,
 	-40, -39, -38, -37, -36, -35, -34, -33, -33, -32, -31, -30, -30, -29, -28, -28, -27, -27, -26, -25, -25,
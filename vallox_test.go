@@ -1,6 +1,16 @@
 package valloxrs485
 
 import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"math/rand"
+	"reflect"
+	"strings"
+	"sync"
 	"testing"
 	"time"
 )
@@ -16,6 +26,30 @@ func TestOutGoingAllowed(t *testing.T) {
 	assertBoolean(false, isOutgoingAllowed(v, TempIncomingInside), t)
 }
 
+func TestWriteRegister(t *testing.T) {
+	v := newTestVallox()
+	if err := v.WriteRegister(DeviceMain, FanSpeed, 0x07); err == nil {
+		t.Errorf("expected error when writing is not enabled")
+	}
+	v.writeAllowed = true
+	if err := v.WriteRegister(DeviceMain, 0xa7, 0x01); err == nil {
+		t.Errorf("expected error for register not allowed")
+	}
+	if err := v.WriteRegister(DeviceMain, 0, FanSpeed); !errors.Is(err, ErrInvalidValue) {
+		t.Errorf("expected error for register 0")
+	}
+	v.writable = map[byte]bool{0xa7: true}
+	if err := v.WriteRegister(DeviceMain, 0xa7, 0x01); err != nil {
+		t.Errorf("expected no error but got %v", err)
+	}
+	if pkg := (<-v.out).pkg; pkg.Destination != DeviceMain || pkg.Register != 0xa7 || pkg.Value != 0x01 {
+		t.Errorf("unexpected package %+v", pkg)
+	}
+	if len(v.out) != 0 {
+		t.Errorf("expected only allowed write to be queued")
+	}
+}
+
 func TestValueToTemp(t *testing.T) {
 	assertTemp(0, -74, t)
 	assertTemp(255, 100, t)
@@ -23,7 +57,40 @@ func TestValueToTemp(t *testing.T) {
 	assertTemp(247, 100, t)
 }
 
+func TestTempConversionTable(t *testing.T) {
+	for i := 1; i < len(tempConversion); i++ {
+		if tempConversion[i] < tempConversion[i-1] {
+			t.Errorf("temp table decreases at raw %d: %d -> %d", i, tempConversion[i-1], tempConversion[i])
+		}
+	}
+	// saturated tail
+	for raw := 247; raw <= 255; raw++ {
+		assertTemp(byte(raw), 100, t)
+	}
+}
+
+func TestTempInverseRoundTrip(t *testing.T) {
+	for _, celsius := range tempConversion {
+		value, ok := tempToValue(celsius)
+		if !ok {
+			t.Fatalf("expected %d to be convertible", celsius)
+		}
+		if c, _ := valueToTemp(value, nil); c != celsius {
+			t.Errorf("temperature %d round trip via raw %d gave %d", celsius, value, c)
+		}
+	}
+	// saturated values use the middle of the saturated range
+	if v, _ := tempToValue(100); v != 251 {
+		t.Errorf("expected 100 to be converted to raw 251 but got %d", v)
+	}
+	// temperatures in gaps are rounded up to the next available value
+	if v, _ := tempToValue(84); v != 243 {
+		t.Errorf("expected 84 to be converted to raw 243 but got %d", v)
+	}
+}
+
 func TestValueToSpeed(t *testing.T) {
+	assertSpeed(0, 0, t)
 	assertSpeed(1, 1, t)
 	assertSpeed(3, 2, t)
 	assertSpeed(7, 3, t)
@@ -74,11 +141,11 @@ func assertRh(t *testing.T, valloxValue byte, rh int16) {
 
 func TestValueToCo2(t *testing.T) {
 	v := new(Vallox)
-	e := event(&valloxPackage{Register: Co2HighestHighByte, Value: 1}, v)
+	e := event(&Package{Register: Co2HighestHighByte, Value: 1}, v)
 	if e != nil {
 		t.Errorf("expected no value, but got one")
 	}
-	e = event(&valloxPackage{Register: Co2HighestLowByte, Value: 0xf4}, v)
+	e = event(&Package{Register: Co2HighestLowByte, Value: 0xf4}, v)
 	if e.Value != 0x1f4 {
 		t.Errorf("expected 0x1fe but got %x", e.Value)
 	}
@@ -89,13 +156,1033 @@ func TestValueToCo2(t *testing.T) {
 
 func TestDelayedToCo2(t *testing.T) {
 	v := new(Vallox)
-	e := event(&valloxPackage{Register: Co2HighestHighByte, Value: 1}, v)
+	e := event(&Package{Register: Co2HighestHighByte, Value: 1}, v)
 	if e != nil {
 		t.Errorf("expected no value, but got one")
 	}
 	time.Sleep(600 * time.Millisecond)
-	e = event(&valloxPackage{Register: Co2HighestLowByte, Value: 0xf4}, v)
+	e = event(&Package{Register: Co2HighestLowByte, Value: 0xf4}, v)
 	if e != nil {
 		t.Errorf("expected no value, but got one")
 	}
 }
+
+func TestSetSpeedOff(t *testing.T) {
+	v := newTestVallox()
+	v.writeAllowed = true
+	if err := v.SetSpeed(0); !errors.Is(err, ErrInvalidValue) || len(v.out) != 0 {
+		t.Errorf("expected speed 0 to be refused without AllowOff but got %v", err)
+	}
+	v.allowOff = true
+	if err := v.SetSpeed(0); err != nil {
+		t.Fatal(err)
+	}
+	if pkg := (<-v.out).pkg; pkg.Register != FanSpeed || pkg.Value != 0x00 {
+		t.Errorf("unexpected package %+v", pkg)
+	}
+	if err := v.SetSpeed(9); !errors.Is(err, ErrInvalidValue) || len(v.out) != 0 {
+		t.Errorf("expected speed 9 to be refused but got %v", err)
+	}
+}
+
+func TestWriteErrors(t *testing.T) {
+	v := newTestVallox()
+	if err := v.SetSpeed(3); !errors.Is(err, ErrWriteDisabled) {
+		t.Errorf("expected writing disabled but got %v", err)
+	}
+	v.writeAllowed = true
+	if err := v.WriteRegister(DeviceMain, TempIncomingInside, 0x80); !errors.Is(err, ErrNotWritable) {
+		t.Errorf("expected register not writable but got %v", err)
+	}
+	v.out = make(chan outgoing, 1)
+	if err := v.Query(FanSpeed); err != nil {
+		t.Fatal(err)
+	}
+	if err := v.Query(FanSpeed); !errors.Is(err, ErrQueueFull) {
+		t.Errorf("expected queue full but got %v", err)
+	}
+	if err := v.SetSpeed(3); !errors.Is(err, ErrQueueFull) {
+		t.Errorf("expected queue full but got %v", err)
+	}
+	if err := <-v.SubmitWrite(DeviceMain, FanSpeed, 0x07); !errors.Is(err, ErrQueueFull) {
+		t.Errorf("expected queue full but got %v", err)
+	}
+	if _, err := v.QueryValues(context.Background(), FanSpeed, TempIncomingInside); !errors.Is(err, ErrQueueFull) {
+		t.Errorf("expected queue full but got %v", err)
+	}
+
+	// main device write fits in the queue, multicast to remotes does not
+	v.out = make(chan outgoing, 1)
+	v.speedMulticast = true
+	if err := v.SetSpeed(3); !errors.Is(err, ErrRemotesNotUpdated) || !errors.Is(err, ErrQueueFull) {
+		t.Errorf("expected remotes not updated but got %v", err)
+	}
+	if pkg := (<-v.out).pkg; pkg.Destination != DeviceMain || pkg.Register != FanSpeed {
+		t.Errorf("expected speed queued to main device but got %+v", pkg)
+	}
+}
+
+func TestSetSpeedTo(t *testing.T) {
+	v := newTestVallox()
+	v.writeAllowed = true
+	v.remoteClientId = 0x27
+	for _, destination := range []byte{0x0f, 0x30} {
+		if err := v.SetSpeedTo(destination, 3); err == nil {
+			t.Errorf("expected error for destination %x", destination)
+		}
+	}
+	if err := v.SetSpeedTo(DeviceMain, 9); err == nil {
+		t.Errorf("expected error for invalid speed")
+	}
+	if len(v.out) != 0 {
+		t.Errorf("expected nothing to be sent")
+	}
+	if err := v.SetSpeedTo(DeviceMulticast, 3); err != nil {
+		t.Fatal(err)
+	}
+	if pkg := (<-v.out).pkg; pkg.Destination != DeviceMulticast || pkg.Register != FanSpeed || pkg.Value != 0x07 {
+		t.Errorf("unexpected package %+v", pkg)
+	}
+}
+
+func TestSetCo2Target(t *testing.T) {
+	v := newTestVallox()
+	v.remoteClientId = 0x27
+	for _, ppm := range []int16{100, maxCo2Target + 1} {
+		if err := v.SetCo2Target(ppm); !errors.Is(err, ErrInvalidValue) {
+			t.Errorf("expected invalid value for target %d but got %v", ppm, err)
+		}
+	}
+	v.running.Store(true)
+	port := &fakePort{}
+	v.port = port
+	go handleOutgoing(v)
+	defer v.Close()
+	if err := v.SetCo2Target(900); !errors.Is(err, ErrWriteDisabled) {
+		t.Errorf("expected error when writing is not enabled but got %v", err)
+	}
+
+	v.writeAllowed = true
+	if err := v.SetCo2Target(900); err != nil {
+		t.Fatalf("expected no error but got %v", err)
+	}
+	expected := append(testFrame(0x27, DeviceMain, Co2TargetHighByte, 0x03), testFrame(0x27, DeviceMain, Co2TargetLowByte, 0x84)...)
+	if !bytes.Equal(port.written, expected) {
+		t.Errorf("expected written frames %x but got %x", expected, port.written)
+	}
+}
+
+func TestValueToCo2Target(t *testing.T) {
+	v := new(Vallox)
+	if e := event(&Package{Register: Co2TargetHighByte, Value: 0x03}, v); e != nil {
+		t.Errorf("expected no value from high byte but got %+v", e)
+	}
+	if e := event(&Package{Register: Co2TargetLowByte, Value: 0x84}, v); e == nil || e.Value != 900 {
+		t.Errorf("expected co2 target 900 but got %+v", e)
+	}
+}
+
+func TestCo2PairWindow(t *testing.T) {
+	v := new(Vallox)
+	v.co2.window = 50 * time.Millisecond
+	event(&Package{Register: Co2HighestHighByte, Value: 1}, v)
+	time.Sleep(20 * time.Millisecond)
+	if e := event(&Package{Register: Co2HighestLowByte, Value: 0xf4}, v); e == nil || e.Value != 0x1f4 {
+		t.Errorf("expected value within window but got %+v", e)
+	}
+	time.Sleep(60 * time.Millisecond)
+	if e := event(&Package{Register: Co2HighestLowByte, Value: 0xf4}, v); e != nil {
+		t.Errorf("expected no value after window but got %+v", e)
+	}
+}
+
+func TestEventSeq(t *testing.T) {
+	v := newTestVallox()
+	v.buf.Write(testFrame(DeviceMain, RemoteClientMulticast, FanSpeed, 0x07))
+	v.buf.Write(testFrame(DeviceMain, RemoteClientMulticast, TempIncomingInside, 0x80))
+	handleBuffer(v)
+
+	for _, expected := range []uint64{1, 2} {
+		e := <-v.in
+		if e.Seq != expected {
+			t.Errorf("expected seq %d but got %d", expected, e.Seq)
+		}
+	}
+}
+
+func newTestVallox() *Vallox {
+	return &Vallox{
+		system:   1,
+		buf:      new(bytes.Buffer),
+		in:       make(chan Event, 50),
+		discards: make(chan Discard, 50),
+		errors:   make(chan error, 10),
+		states:   make(chan ConnectionState, 10),
+		out:      make(chan outgoing, 50),
+		done:     make(chan struct{}),
+		logger:   nopLogger{},
+	}
+}
+
+// drainEvents discards events so that the reader never blocks
+func drainEvents(v *Vallox) {
+	for range v.in {
+	}
+}
+
+func testFrame(source, destination, register, value byte) []byte {
+	return testSystemFrame(1, source, destination, register, value)
+}
+
+func testSystemFrame(system, source, destination, register, value byte) []byte {
+	pkg := Package{System: system, Source: source, Destination: destination, Register: register, Value: value}
+	pkg.Checksum = CalculateChecksum(pkg)
+	return []byte{pkg.System, pkg.Source, pkg.Destination, pkg.Register, pkg.Value, pkg.Checksum}
+}
+
+func TestOpenDeviceNoMatch(t *testing.T) {
+	if _, _, err := openDevice("", "/nonexistent/ttyUSB*", defaultBaud); err == nil {
+		t.Errorf("expected error when glob matches nothing")
+	}
+	if _, _, err := openDevice("/nonexistent/ttyUSB0", "/nonexistent/ttyUSB*", defaultBaud); err == nil {
+		t.Errorf("expected error when device does not exist")
+	}
+	if _, _, err := openDevice("/dev/null", "", 12345); err == nil || !strings.Contains(err.Error(), "12345") {
+		t.Errorf("expected error mentioning unsupported baud but got %v", err)
+	}
+}
+
+func TestSystemFiltering(t *testing.T) {
+	for _, system := range []byte{0, 1, 2, 0xff} {
+		frame := testSystemFrame(system, DeviceMain, RemoteClientMulticast, FanSpeed, 0x07)
+		assertBoolean(system == 1, validPackage(frame, 1) != nil, t)
+		assertBoolean(system == 2, validPackage(frame, 2) != nil, t)
+	}
+
+	v := newTestVallox()
+	v.system = 2
+	v.buf.Write(testSystemFrame(1, DeviceMain, RemoteClientMulticast, FanSpeed, 0x07))
+	v.buf.Write(testSystemFrame(2, DeviceMain, RemoteClientMulticast, FanSpeed, 0x0f))
+	handleBuffer(v)
+	if e := <-v.in; e.Value != 4 {
+		t.Errorf("expected event from system 2 with speed 4 but got %d", e.Value)
+	}
+	if len(v.in) != 0 {
+		t.Errorf("expected frame from system 1 to be discarded")
+	}
+	if pkg := createQuery(v, DeviceMain, FanSpeed); pkg.System != 2 {
+		t.Errorf("expected outgoing system 2 but got %d", pkg.System)
+	}
+}
+
+func TestNormalizeTempRegisters(t *testing.T) {
+	v := new(Vallox)
+	e := event(&Package{Register: TempIncomingOutside, Value: 0x80}, v)
+	if e.Register != TempIncomingOutside {
+		t.Errorf("expected register %x but got %x", TempIncomingOutside, e.Register)
+	}
+
+	v.normalize = true
+	for old, normalized := range normalizedTempRegisters {
+		e := event(&Package{Register: old, Value: 0x80}, v)
+		if e.Register != normalized {
+			t.Errorf("expected register %x normalized to %x but got %x", old, normalized, e.Register)
+		}
+		if e.Value != tempConversion[0x80] {
+			t.Errorf("expected temperature %d but got %d", tempConversion[0x80], e.Value)
+		}
+	}
+	e = event(&Package{Register: TempIncomingOutsideNew, Value: 0x80}, v)
+	if e.Register != TempIncomingOutsideNew {
+		t.Errorf("expected register %x but got %x", TempIncomingOutsideNew, e.Register)
+	}
+}
+
+func TestLastFrameFromSource(t *testing.T) {
+	v := newTestVallox()
+	if _, _, found := v.LastFrameFromSource(DeviceMain); found {
+		t.Errorf("expected no frame before any traffic")
+	}
+	v.buf.Write(testFrame(DeviceMain, RemoteClientMulticast, FanSpeed, 0x07))
+	v.buf.Write(testFrame(0x21, DeviceMain, 0, FanSpeed))
+	v.buf.Write(testFrame(DeviceMain, RemoteClientMulticast, FanSpeed, 0x0f))
+	handleBuffer(v)
+
+	frame, at, found := v.LastFrameFromSource(DeviceMain)
+	if !found || at.IsZero() {
+		t.Fatalf("expected frame from main device")
+	}
+	if expected := testFrame(DeviceMain, RemoteClientMulticast, FanSpeed, 0x0f); !bytes.Equal(frame[:], expected) {
+		t.Errorf("expected frame %x but got %x", expected, frame)
+	}
+	if frame, _, _ := v.LastFrameFromSource(0x21); frame[1] != 0x21 {
+		t.Errorf("unexpected frame from 0x21 %x", frame)
+	}
+}
+
+func TestTempTable(t *testing.T) {
+	table := tempConversion
+	for i := range table {
+		table[i] += 2
+	}
+	cfg := Config{TempTable: &table}
+	if err := applyDefaults(&cfg); err != nil {
+		t.Fatal(err)
+	}
+	v := newTestVallox()
+	v.tempTable = cfg.TempTable
+	if e := event(&Package{Register: TempIncomingOutside, Value: 160}, v); e.Value != 22 {
+		t.Errorf("expected 22 from custom table but got %d", e.Value)
+	}
+	v.writeAllowed = true
+	if err := v.SetHeatingTarget(22); err != nil {
+		t.Fatal(err)
+	}
+	if pkg := (<-v.out).pkg; pkg.Value != 160 {
+		t.Errorf("expected raw 160 from custom table but got %d", pkg.Value)
+	}
+
+	table[10] = table[9] - 1
+	if err := applyDefaults(&Config{TempTable: &table}); err == nil {
+		t.Errorf("expected error for decreasing table")
+	}
+}
+
+func TestTempToValue(t *testing.T) {
+	for celsius := int16(-74); celsius <= 100; celsius++ {
+		value, ok := tempToValue(celsius)
+		if !ok {
+			t.Fatalf("expected %d to be convertible", celsius)
+		}
+		if c, _ := valueToTemp(value, nil); c < celsius {
+			t.Errorf("temperature %d converted to raw %d which is %d", celsius, value, c)
+		}
+	}
+	if v, _ := tempToValue(20); v != 160 {
+		t.Errorf("expected 20 to be converted to middle raw value 160 but got %d", v)
+	}
+	if _, ok := tempToValue(-75); ok {
+		t.Errorf("expected -75 not to be convertible")
+	}
+	if _, ok := tempToValue(101); ok {
+		t.Errorf("expected 101 not to be convertible")
+	}
+}
+
+func TestSetHeatingTarget(t *testing.T) {
+	v := newTestVallox()
+	v.writeAllowed = true
+	if err := v.SetHeatingTarget(40); err == nil {
+		t.Errorf("expected error for too high target")
+	}
+	if err := v.SetHeatingTarget(20); err != nil {
+		t.Fatalf("expected no error but got %v", err)
+	}
+	pkg := (<-v.out).pkg
+	if pkg.Destination != DeviceMain || pkg.Register != HeatingTarget || pkg.Value != 160 {
+		t.Errorf("unexpected package %+v", pkg)
+	}
+}
+
+func TestWriteMinGapKeepsOrder(t *testing.T) {
+	v := newTestVallox()
+	v.remoteClientId = 0x27
+	v.writeMinGap = 20 * time.Millisecond
+	v.running.Store(true)
+	port := &fakePort{}
+	v.port = port
+	v.updateLastReceived()
+	start := time.Now()
+
+	var results []<-chan error
+	for _, register := range []byte{FanSpeed, Rh1, TempIncomingInside} {
+		results = append(results, v.SubmitWrite(DeviceMain, 0, register))
+	}
+	go handleOutgoing(v)
+	defer v.Close()
+	for _, result := range results {
+		if err := <-result; err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if elapsed := time.Since(start); elapsed < 3*v.writeMinGap {
+		t.Errorf("expected gap between frames, all sent in %v", elapsed)
+	}
+	expected := append(append(testFrame(0x27, DeviceMain, 0, FanSpeed), testFrame(0x27, DeviceMain, 0, Rh1)...), testFrame(0x27, DeviceMain, 0, TempIncomingInside)...)
+	if !bytes.Equal(port.written, expected) {
+		t.Errorf("expected frames in order %x but got %x", expected, port.written)
+	}
+}
+
+func TestWriteMinGapFromConfig(t *testing.T) {
+	for _, test := range []struct {
+		gap, expected time.Duration
+	}{
+		{0, defaultWriteMinGap},
+		{5 * time.Millisecond, 5 * time.Millisecond},
+	} {
+		r, w := io.Pipe()
+		v, err := OpenPort(Config{WriteMinGap: test.gap}, pipePort{r})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if gap := v.minGap(); gap != test.expected {
+			t.Errorf("expected write gap %v but got %v", test.expected, gap)
+		}
+		v.Close()
+		w.Close()
+	}
+}
+
+func TestIdleSince(t *testing.T) {
+	v := newTestVallox()
+	v.updateLastReceived()
+	time.Sleep(110 * time.Millisecond)
+	// own transmission does not reset idle time
+	if !v.ifBusFreeProceed() {
+		t.Fatalf("expected bus to be free")
+	}
+	if idle := v.IdleSince(); idle < 110*time.Millisecond {
+		t.Errorf("expected idle at least 110ms but got %v", idle)
+	}
+	v.updateLastReceived()
+	if idle := v.IdleSince(); idle >= 110*time.Millisecond {
+		t.Errorf("expected idle to be reset by received data but got %v", idle)
+	}
+}
+
+func TestListenBeforeTalk(t *testing.T) {
+	v := newTestVallox()
+	v.writeMinGap = 20 * time.Millisecond
+	if !v.ifBusFreeProceed() {
+		t.Fatalf("expected quiet bus to be free")
+	}
+	// own transmission holds off the next one
+	if v.ifBusFreeProceed() {
+		t.Errorf("expected bus to be busy right after sending")
+	}
+	time.Sleep(25 * time.Millisecond)
+	// received bytes hold off sending
+	v.updateLastReceived()
+	if v.ifBusFreeProceed() {
+		t.Errorf("expected bus to be busy right after receiving")
+	}
+	time.Sleep(25 * time.Millisecond)
+	if !v.ifBusFreeProceed() {
+		t.Errorf("expected bus to be free after the gap")
+	}
+}
+
+func TestEventTransform(t *testing.T) {
+	v := newTestVallox()
+	v.SetEventTransform(func(e Event) Event {
+		if e.Register == TempIncomingInside {
+			return Event{}
+		}
+		e.Value *= 10
+		return e
+	})
+	handlePackage(&Package{Register: TempIncomingInside, Value: 0x80}, v)
+	handlePackage(&Package{Register: FanSpeed, Value: 0x07}, v)
+
+	e := <-v.in
+	if e.Register != FanSpeed || e.Value != 30 {
+		t.Errorf("expected transformed speed 30 but got %+v", e)
+	}
+	if e.Seq != 1 {
+		t.Errorf("expected dropped event not to use a sequence number but got seq %d", e.Seq)
+	}
+	if len(v.in) != 0 {
+		t.Errorf("expected dropped event not to be delivered")
+	}
+
+	v.SetEventTransform(nil)
+	handlePackage(&Package{Register: FanSpeed, Value: 0x07}, v)
+	if e := <-v.in; e.Value != 3 {
+		t.Errorf("expected untransformed speed 3 but got %d", e.Value)
+	}
+}
+
+// fakePort returns data and io.EOF when data is consumed, and records written data
+type fakePort struct {
+	data    []byte
+	reads   int
+	written []byte
+}
+
+func (p *fakePort) Read(b []byte) (int, error) {
+	if len(p.data) == 0 {
+		return 0, io.EOF
+	}
+	p.reads++
+	n := copy(b, p.data)
+	p.data = p.data[n:]
+	return n, nil
+}
+
+func (p *fakePort) Write(b []byte) (int, error) {
+	p.written = append(p.written, b...)
+	return len(b), nil
+}
+
+func (p *fakePort) Close() error { return nil }
+
+func TestSeveralFramesInOneRead(t *testing.T) {
+	v := newTestVallox()
+	v.readBufferSize = defaultReadBufferSize
+	port := &fakePort{}
+	for _, value := range []byte{0x01, 0x03, 0x07, 0x0f} {
+		port.data = append(port.data, testFrame(DeviceMain, RemoteClientMulticast, FanSpeed, value)...)
+	}
+	// partial frame at the end is kept for the next read
+	port.data = append(port.data, 0x01, DeviceMain)
+	v.port = port
+	handleIncoming(v)
+
+	if port.reads != 1 {
+		t.Errorf("expected all frames in one read but got %d reads", port.reads)
+	}
+	for speed := int16(1); speed <= 4; speed++ {
+		if e := <-v.in; e.Value != speed {
+			t.Errorf("expected speed %d but got %d", speed, e.Value)
+		}
+	}
+	if v.buf.Len() != 2 {
+		t.Errorf("expected partial frame to be buffered but got %d bytes", v.buf.Len())
+	}
+}
+
+func BenchmarkRead(b *testing.B) {
+	for _, size := range []int{6, defaultReadBufferSize} {
+		b.Run(fmt.Sprintf("buffer%d", size), func(b *testing.B) {
+			frames := bytes.Repeat(testFrame(DeviceMain, RemoteClientMulticast, TempIncomingInside, 0x80), 40)
+			v := newTestVallox()
+			v.readBufferSize = size
+			go drainEvents(v)
+			reads := 0
+			for i := 0; i < b.N; i++ {
+				port := &fakePort{data: frames}
+				v.port = port
+				handleIncoming(v)
+				reads += port.reads
+			}
+			b.ReportMetric(float64(reads)/float64(b.N), "reads/op")
+		})
+	}
+}
+
+// endlessPort returns frame followed by a partial frame on every read
+type endlessPort struct {
+	frame []byte
+}
+
+func (p *endlessPort) Read(b []byte) (int, error) {
+	time.Sleep(time.Millisecond)
+	return copy(b, append(append([]byte{}, p.frame...), p.frame[:3]...)), nil
+}
+
+func (p *endlessPort) Write(b []byte) (int, error) { return len(b), nil }
+
+func (p *endlessPort) Close() error { return nil }
+
+func TestStopDuringParsing(t *testing.T) {
+	v := newTestVallox()
+	v.readBufferSize = defaultReadBufferSize
+	var logged bytes.Buffer
+	v.logger = stdLogger{log.New(&logged, "", 0)}
+	v.port = &endlessPort{frame: testFrame(DeviceMain, RemoteClientMulticast, FanSpeed, 0x07)}
+	go drainEvents(v)
+	done := make(chan bool)
+	go func() {
+		handleIncoming(v)
+		close(done)
+	}()
+	time.Sleep(20 * time.Millisecond)
+	v.running.Store(false)
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatalf("reader did not stop")
+	}
+	if !strings.Contains(logged.String(), "reader stopped with partial frame") {
+		t.Errorf("expected partial frame to be logged but got %q", logged.String())
+	}
+}
+
+// pipePort reads from a pipe until closed and discards writes
+type pipePort struct {
+	*io.PipeReader
+}
+
+func (p pipePort) Write(b []byte) (int, error) { return len(b), nil }
+
+func TestClose(t *testing.T) {
+	r, w := io.Pipe()
+	v := newTestVallox()
+	v.readBufferSize = defaultReadBufferSize
+	v.port = pipePort{r}
+	var wg sync.WaitGroup
+	wg.Add(2)
+	go func() {
+		handleIncoming(v)
+		wg.Done()
+	}()
+	go func() {
+		handleOutgoing(v)
+		wg.Done()
+	}()
+
+	go w.Write(testFrame(DeviceMain, RemoteClientMulticast, FanSpeed, 0x07))
+	if e := <-v.Events(); e.Value != 3 {
+		t.Errorf("expected speed 3 but got %d", e.Value)
+	}
+	if err := v.Close(); err != nil {
+		t.Errorf("unexpected error %v", err)
+	}
+	for range v.Events() {
+	}
+	wg.Wait()
+	if err := v.Close(); err != nil {
+		t.Errorf("expected second close to succeed but got %v", err)
+	}
+}
+
+func TestCloseBeforeReaderStarts(t *testing.T) {
+	r, _ := io.Pipe()
+	v := newTestVallox()
+	v.port = pipePort{r}
+	v.Close()
+	handleIncoming(v)
+
+	select {
+	case _, ok := <-v.Events():
+		if ok {
+			t.Errorf("expected no events")
+		}
+	case <-time.After(time.Second):
+		t.Fatalf("events not closed when reader started after Close")
+	}
+}
+
+func TestOpenPort(t *testing.T) {
+	tests := []struct {
+		name     string
+		cfg      Config
+		data     []byte
+		expected []int16
+	}{
+		{"speed", Config{}, testFrame(DeviceMain, RemoteClientMulticast, FanSpeed, 0x07), []int16{3}},
+		{"two frames", Config{}, append(testFrame(DeviceMain, RemoteClientMulticast, FanSpeed, 0x07),
+			testFrame(DeviceMain, RemoteClientMulticast, FanSpeed, 0x0f)...), []int16{3, 4}},
+		{"other system", Config{System: 2}, append(testFrame(DeviceMain, RemoteClientMulticast, FanSpeed, 0x07),
+			testSystemFrame(2, DeviceMain, RemoteClientMulticast, FanSpeed, 0x0f)...), []int16{4}},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			r, w := io.Pipe()
+			v, err := OpenPort(test.cfg, pipePort{r})
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer v.Close()
+			go w.Write(test.data)
+			for _, expected := range test.expected {
+				select {
+				case e := <-v.Events():
+					if e.Value != expected {
+						t.Errorf("expected value %d but got %d", expected, e.Value)
+					}
+				case <-time.After(time.Second):
+					t.Fatalf("no event received")
+				}
+			}
+		})
+	}
+	if _, err := OpenPort(Config{RemoteClientId: 0x11}, pipePort{}); err == nil {
+		t.Errorf("expected error for invalid remote client id")
+	}
+}
+
+// respondingPort answers fan speed queries like the main device
+type respondingPort struct {
+	r *io.PipeReader
+	w *io.PipeWriter
+}
+
+func newRespondingPort() *respondingPort {
+	r, w := io.Pipe()
+	return &respondingPort{r, w}
+}
+
+func (p *respondingPort) Read(b []byte) (int, error) { return p.r.Read(b) }
+
+func (p *respondingPort) Write(b []byte) (int, error) {
+	if b[3] == 0 && b[4] == FanSpeed {
+		go p.w.Write(testFrame(DeviceMain, b[1], FanSpeed, 0x07))
+	}
+	return len(b), nil
+}
+
+func (p *respondingPort) Close() error { return p.r.Close() }
+
+func openPortFunc(port io.ReadWriteCloser) func() (io.ReadWriteCloser, string, error) {
+	return func() (io.ReadWriteCloser, string, error) { return port, "test", nil }
+}
+
+func TestOpenContext(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	cfg := Config{}
+	applyDefaults(&cfg)
+	v, err := openContext(ctx, cfg, openPortFunc(newRespondingPort()), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, found := v.LastValue(FanSpeed); !found {
+		t.Errorf("expected fan speed to be received during open")
+	}
+	cancel()
+	select {
+	case <-v.done:
+	case <-time.After(time.Second):
+		t.Fatalf("cancelling context did not close connection")
+	}
+}
+
+func TestOpenContextNoResponse(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	cfg := Config{}
+	applyDefaults(&cfg)
+	r, w := io.Pipe()
+	defer w.Close()
+	if _, err := openContext(ctx, cfg, openPortFunc(pipePort{r}), nil); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("expected deadline exceeded but got %v", err)
+	}
+	if _, err := w.Write([]byte{0}); err != io.ErrClosedPipe {
+		t.Errorf("expected port to be closed but got %v", err)
+	}
+}
+
+func TestOpenContextCancelledWhileOpening(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	cfg := Config{}
+	applyDefaults(&cfg)
+	r, w := io.Pipe()
+	release := make(chan struct{})
+	go func() {
+		time.Sleep(10 * time.Millisecond)
+		cancel()
+	}()
+	_, err := openContext(ctx, cfg, func() (io.ReadWriteCloser, string, error) {
+		<-release
+		return pipePort{r}, "test", nil
+	}, nil)
+	if !errors.Is(err, context.Canceled) {
+		t.Errorf("expected cancellation but got %v", err)
+	}
+	close(release)
+	if _, err := w.Write([]byte{0}); err != io.ErrClosedPipe {
+		t.Errorf("expected port opened late to be closed but got %v", err)
+	}
+}
+
+func TestOpenContextReconnects(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	cfg := Config{ReconnectInterval: time.Millisecond}
+	applyDefaults(&cfg)
+	// the first port fails while waiting for the main device
+	v, err := openContext(ctx, cfg, openPortFunc(failingPort{}), func() (io.ReadWriteCloser, error) {
+		return newRespondingPort(), nil
+	})
+	if err != nil {
+		t.Fatalf("expected reconnect during open but got %v", err)
+	}
+	v.Close()
+}
+
+func TestCloseWithBlockedConsumer(t *testing.T) {
+	v := newTestVallox()
+	v.in = make(chan Event)
+	v.readBufferSize = defaultReadBufferSize
+	v.port = &endlessPort{frame: testFrame(DeviceMain, RemoteClientMulticast, FanSpeed, 0x07)}
+	done := make(chan bool)
+	go func() {
+		handleIncoming(v)
+		close(done)
+	}()
+	time.Sleep(10 * time.Millisecond)
+	v.Close()
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatalf("reader did not stop")
+	}
+	if _, ok := <-v.Events(); ok {
+		t.Errorf("expected events channel to be closed")
+	}
+}
+
+func TestQueryDevice(t *testing.T) {
+	v := newTestVallox()
+	v.remoteClientId = 0x27
+	v.QueryDevice(DeviceSecondary, FanSpeed)
+	if o := <-v.out; o.pkg.Destination != DeviceSecondary || o.pkg.Register != 0 || o.pkg.Value != FanSpeed {
+		t.Errorf("unexpected query %+v", o.pkg)
+	}
+}
+
+func TestIsMainDevice(t *testing.T) {
+	for address, expected := range map[byte]bool{DeviceMulticast: false, DeviceMain: true, DeviceSecondary: true, 0x1f: true, RemoteClientMulticast: false, 0x27: false} {
+		assertBoolean(expected, IsMainDevice(address), t)
+	}
+}
+
+func TestDecodeFrame(t *testing.T) {
+	frame := testFrame(DeviceMain, RemoteClientMulticast, FanSpeed, 0x07)
+	pkg, ok := DecodeFrame(frame)
+	if !ok || pkg != (Package{1, DeviceMain, RemoteClientMulticast, FanSpeed, 0x07, frame[5]}) {
+		t.Errorf("unexpected package %+v %v", pkg, ok)
+	}
+	if !bytes.Equal(EncodeFrame(pkg), frame) {
+		t.Errorf("expected frame %x but got %x", frame, EncodeFrame(pkg))
+	}
+	frame[5]++
+	if _, ok := DecodeFrame(frame); ok {
+		t.Errorf("expected invalid checksum")
+	}
+	if _, ok := DecodeFrame(frame[:5]); ok {
+		t.Errorf("expected short frame to be invalid")
+	}
+}
+
+func TestFrameRoundTrip(t *testing.T) {
+	for _, pkg := range []Package{
+		{1, DeviceMain, RemoteClientMulticast, FanSpeed, 0x07, 0},
+		{1, 0x27, DeviceMain, 0, TempIncomingOutside, 0},
+		{2, 0xff, 0x00, 0x80, 0xfe, 0},
+	} {
+		pkg.Checksum = CalculateChecksum(pkg)
+		frame := EncodeFrame(pkg)
+		expected := []byte{pkg.System, pkg.Source, pkg.Destination, pkg.Register, pkg.Value, pkg.Checksum}
+		if !bytes.Equal(frame, expected) {
+			t.Errorf("expected frame %x but got %x", expected, frame)
+		}
+		decoded := validPackage(frame, pkg.System)
+		if decoded == nil || *decoded != pkg {
+			t.Errorf("expected %+v after round trip but got %+v", pkg, decoded)
+		}
+	}
+}
+
+func TestEventToFrame(t *testing.T) {
+	frame := testFrame(DeviceMain, RemoteClientMulticast, TempIncomingInside, 0x80)
+	e := event(validPackage(frame, 1), newTestVallox())
+	if f := e.ToFrame(1); !bytes.Equal(f[:], frame) {
+		t.Errorf("expected frame %x but got %x", frame, f)
+	}
+}
+
+func TestNextFrame(t *testing.T) {
+	rnd := rand.New(rand.NewSource(1))
+	for n := 0; n < 1000; n++ {
+		buf := make([]byte, rnd.Intn(40))
+		rnd.Read(buf)
+		if len(buf) > 6 && n%2 == 0 {
+			at := rnd.Intn(len(buf) - 5)
+			copy(buf[at:], testFrame(DeviceMain, RemoteClientMulticast, FanSpeed, byte(n)))
+		}
+		expected := -1
+		for i := 0; i+6 <= len(buf); i++ {
+			if validPackage(buf[i:], 1) != nil {
+				expected = i
+				break
+			}
+		}
+		if offset, _ := nextFrame(buf, 1); offset != expected {
+			t.Fatalf("expected offset %d but got %d for %x", expected, offset, buf)
+		}
+	}
+}
+
+func BenchmarkResync(b *testing.B) {
+	noise := bytes.Repeat([]byte{0x00, 0x11, 0x22, 0x33, 0x44, 0x55, 0x66}, 20)
+	data := append(noise, testFrame(DeviceMain, RemoteClientMulticast, FanSpeed, 0x07)...)
+	v := newTestVallox()
+	go drainEvents(v)
+	for i := 0; i < b.N; i++ {
+		v.buf.Write(data)
+		handleBuffer(v)
+	}
+}
+
+func TestSubmitWrite(t *testing.T) {
+	v := newTestVallox()
+	v.remoteClientId = 0x27
+	v.running.Store(true)
+	port := &fakePort{}
+	v.port = port
+	go handleOutgoing(v)
+
+	if err := <-v.SubmitWrite(DeviceMain, FanSpeed, 0x07); err == nil {
+		t.Errorf("expected error when writing is not enabled")
+	}
+
+	v.writeAllowed = true
+	if err := <-v.SubmitWrite(DeviceMain, FanSpeed, 0x07); err != nil {
+		t.Errorf("expected no error but got %v", err)
+	}
+	if expected := testFrame(0x27, DeviceMain, FanSpeed, 0x07); !bytes.Equal(port.written, expected) {
+		t.Errorf("expected written frame %x but got %x", expected, port.written)
+	}
+}
+
+func TestValueToPreheating(t *testing.T) {
+	for raw, expected := range map[byte]int16{0x00: 0, 0x7f: 0, 0x80: 1, 0xff: 1} {
+		if v, ok := valueToPreheating(raw, nil); !ok || v != expected {
+			t.Errorf("preheating raw %x expected %d but got %d", raw, expected, v)
+		}
+	}
+}
+
+func TestSetProtectionSettings(t *testing.T) {
+	v := newTestVallox()
+	v.writeAllowed = true
+	if err := v.SetHumidityLimit(100); err == nil {
+		t.Errorf("expected error for too high humidity limit")
+	}
+	if err := v.SetBypassTemp(30); err == nil {
+		t.Errorf("expected error for too high bypass temperature")
+	}
+	if err := v.SetHumidityLimit(50); err != nil {
+		t.Fatalf("expected no error but got %v", err)
+	}
+	if pkg := (<-v.out).pkg; pkg.Register != HumidityLimit || pkg.Value != 0x99 {
+		t.Errorf("unexpected package %+v", pkg)
+	}
+	if err := v.SetBypassTemp(20); err != nil {
+		t.Fatalf("expected no error but got %v", err)
+	}
+	if pkg := (<-v.out).pkg; pkg.Register != BypassTemp || pkg.Value != 160 {
+		t.Errorf("unexpected package %+v", pkg)
+	}
+}
+
+func TestSetSpeedMulticast(t *testing.T) {
+	v := newTestVallox()
+	v.writeAllowed = true
+	v.speedMulticast = true
+	v.SetSpeed(3)
+	if pkg := (<-v.out).pkg; pkg.Destination != DeviceMain {
+		t.Errorf("expected write to main device but got %+v", pkg)
+	}
+	if pkg := (<-v.out).pkg; pkg.Destination != RemoteClientMulticast {
+		t.Errorf("expected write to remotes but got %+v", pkg)
+	}
+
+	v.speedMulticast = false
+	v.SetSpeed(3)
+	if pkg := (<-v.out).pkg; pkg.Destination != DeviceMain {
+		t.Errorf("expected write to main device but got %+v", pkg)
+	}
+	if len(v.out) != 0 {
+		t.Errorf("expected no write to remotes")
+	}
+}
+
+func TestConcurrentSetSpeedAndQuery(t *testing.T) {
+	v := newTestVallox()
+	v.writeAllowed = true
+	go drainEvents(v)
+	go func() {
+		for range v.out {
+		}
+	}()
+
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			for j := 0; j < 20; j++ {
+				v.SetSpeed(byte(1 + (i+j)%8))
+				v.Query(FanSpeed)
+				v.LastValue(FanSpeed)
+				v.Connection()
+			}
+		}(i)
+	}
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		for j := 0; j < 100; j++ {
+			handlePackage(&Package{Register: FanSpeed, Value: 0x07}, v)
+		}
+	}()
+	wg.Wait()
+}
+
+func TestPointerReceivers(t *testing.T) {
+	// Methods with value receivers would copy mutexes and state
+	typ := reflect.TypeOf((*Vallox)(nil)).Elem()
+	for i := 0; i < typ.NumMethod(); i++ {
+		t.Errorf("method %s has value receiver", typ.Method(i).Name)
+	}
+}
+
+func TestStatePersistsBetweenCalls(t *testing.T) {
+	v := newTestVallox()
+	v.remoteClientId = 0x27
+	v.writeAllowed = true
+	go drainEvents(v)
+	fakeSpeedDevice(t, v, 0x01, func(n int) bool { return true })
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	if err := v.SetSpeed(4); err != nil {
+		t.Fatal(err)
+	}
+	// the write is seen by the device before the later query
+	e, err := v.Get(ctx, FanSpeed)
+	if err != nil || e.Value != 4 {
+		t.Fatalf("expected speed 4 from later query but got %+v, %v", e, err)
+	}
+	// and the received value is kept for later calls
+	if last, found := v.LastValue(FanSpeed); !found || last.Value != 4 {
+		t.Errorf("expected last speed 4 but got %+v", last)
+	}
+}
+
+func TestPercentToSpeed(t *testing.T) {
+	for _, c := range []struct {
+		pct, min, max, speed int
+	}{
+		{0, 1, 8, 1}, {100, 1, 8, 8}, {50, 1, 8, 5},
+		{0, 2, 5, 2}, {33, 2, 5, 3}, {66, 2, 5, 4}, {100, 2, 5, 5},
+		{0, 4, 4, 4}, {100, 4, 4, 4},
+	} {
+		if s := percentToSpeed(byte(c.pct), int16(c.min), int16(c.max)); s != byte(c.speed) {
+			t.Errorf("%d%% of %d-%d expected speed %d but got %d", c.pct, c.min, c.max, c.speed, s)
+		}
+	}
+}
+
+func TestSetSpeedPercentClamped(t *testing.T) {
+	v := newTestVallox()
+	v.writeAllowed = true
+	if err := v.SetSpeedPercentClamped(50); !errors.Is(err, ErrNotReceived) {
+		t.Errorf("expected error when limits are not known but got %v", err)
+	}
+	v.cache.put(Event{Register: FanSpeedMin, Value: 2})
+	v.cache.put(Event{Register: FanSpeedMax, Value: 6})
+	if err := v.SetSpeedPercentClamped(101); !errors.Is(err, ErrInvalidValue) {
+		t.Errorf("expected error for invalid percentage but got %v", err)
+	}
+	if err := v.SetSpeedPercentClamped(50); err != nil {
+		t.Fatalf("expected no error but got %v", err)
+	}
+	if pkg := (<-v.out).pkg; pkg.Register != FanSpeed || pkg.Value != speedToValue(4) {
+		t.Errorf("expected speed 4 but got %+v", pkg)
+	}
+}
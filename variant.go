@@ -0,0 +1,100 @@
+package valloxrs485
+
+import "sync"
+
+// Variant tells which temperature registers a unit broadcasts
+type Variant int
+
+const (
+	// VariantUnknown means not enough temperatures have been received yet
+	VariantUnknown Variant = iota
+	// VariantOld units broadcast temperatures in registers 0x58-0x5c, e.g.
+	// TempIncomingOutside
+	VariantOld
+	// VariantNew units broadcast temperatures in registers 0x32-0x35, e.g.
+	// TempIncomingOutsideNew
+	VariantNew
+)
+
+func (v Variant) String() string {
+	switch v {
+	case VariantOld:
+		return "Old"
+	case VariantNew:
+		return "New"
+	}
+	return "Unknown"
+}
+
+// variantFrames is the number of temperature frames from the main device
+// after which the variant is decided, two rounds of the four temperatures
+const variantFrames = 8
+
+// variantDetector counts temperature frames of both register sets, the set
+// first reaching variantFrames decides the variant permanently
+type variantDetector struct {
+	mutex   sync.Mutex
+	old     int
+	new     int
+	variant Variant
+}
+
+func (d *variantDetector) observe(register byte) {
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+	if d.variant != VariantUnknown {
+		return
+	}
+	if _, found := normalizedTempRegisters[register]; found {
+		d.old++
+	} else if newTempRegisters[register] {
+		d.new++
+	}
+	if d.old >= variantFrames {
+		d.variant = VariantOld
+	} else if d.new >= variantFrames {
+		d.variant = VariantNew
+	}
+}
+
+func (d *variantDetector) get() Variant {
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+	return d.variant
+}
+
+var newTempRegisters = map[byte]bool{
+	TempIncomingOutsideNew: true,
+	TempOutgoingInsideNew:  true,
+	TempIncomingInsideNew:  true,
+	TempOutgoingOutsideNew: true,
+}
+
+// ProtocolVariant returns which temperature registers the main device has
+// been observed to broadcast.  The variant is decided after a few seconds of
+// traffic and does not change after that.  Snapshot uses it to report
+// temperatures only from the registers of the detected variant.
+func (vallox *Vallox) ProtocolVariant() Variant {
+	return vallox.variant.get()
+}
+
+// snapshotVariant returns variant used to select temperature registers in
+// snapshots, with normalized registers all temperatures are in new registers
+func (vallox *Vallox) snapshotVariant() Variant {
+	if vallox.normalize {
+		return VariantUnknown
+	}
+	return vallox.ProtocolVariant()
+}
+
+// tempReading returns the latest temperature from the registers of variant,
+// or from either register if the variant is not known
+func tempReading(values map[byte]Event, variant Variant, old, new byte) Reading {
+	switch variant {
+	case VariantOld:
+		return reading(values, old)
+	case VariantNew:
+		return reading(values, new)
+	}
+	return reading(values, old, new)
+}
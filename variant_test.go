@@ -0,0 +1,45 @@
+package valloxrs485
+
+import "testing"
+
+func broadcastTemps(v *Vallox, source byte, registers ...byte) {
+	for _, register := range registers {
+		handlePackage(&Package{Source: source, Destination: RemoteClientMulticast, Register: register, Value: 0xa0}, v)
+	}
+}
+
+func TestProtocolVariant(t *testing.T) {
+	v := newTestVallox()
+	go drainEvents(v)
+	old := []byte{TempIncomingOutside, TempOutgoingInside, TempIncomingInside, TempOutgoingOutside}
+
+	broadcastTemps(v, DeviceMain, old...)
+	broadcastTemps(v, RemoteClientMulticast+7, TempIncomingOutsideNew, TempIncomingOutsideNew, TempIncomingOutsideNew, TempIncomingOutsideNew)
+	if variant := v.ProtocolVariant(); variant != VariantUnknown {
+		t.Errorf("expected unknown variant but got %v", variant)
+	}
+	broadcastTemps(v, DeviceMain, old...)
+	if variant := v.ProtocolVariant(); variant != VariantOld {
+		t.Errorf("expected old variant but got %v", variant)
+	}
+	broadcastTemps(v, DeviceMain, TempIncomingOutsideNew, TempIncomingOutsideNew, TempIncomingOutsideNew, TempIncomingOutsideNew,
+		TempIncomingOutsideNew, TempIncomingOutsideNew, TempIncomingOutsideNew, TempIncomingOutsideNew)
+	if variant := v.ProtocolVariant(); variant != VariantOld {
+		t.Errorf("expected variant to stay old but got %v", variant)
+	}
+}
+
+func TestSnapshotUsesVariant(t *testing.T) {
+	v := newTestVallox()
+	go drainEvents(v)
+	for i := 0; i < variantFrames; i++ {
+		broadcastTemps(v, DeviceMain, TempIncomingOutsideNew)
+	}
+	// a stray value in the old register is ignored once the variant is known
+	handlePackage(&Package{Source: DeviceMain, Destination: RemoteClientMulticast, Register: TempIncomingOutside, Value: 0x64}, v)
+
+	s := v.Snapshot()
+	if !s.TempIncomingOutside.Valid || s.TempIncomingOutside.Value != 20 {
+		t.Errorf("expected temperature 20 from new register but got %+v", s.TempIncomingOutside)
+	}
+}